@@ -0,0 +1,172 @@
+// Copyright 2012 The Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package postpone
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// AtomicWriter fulfills the io.WriteSeeker and io.WriteCloser
+// interfaces. Like Writer, it touches the filesystem only once
+// it is first written to, at which point it creates a temporary
+// file in the directory of its destination. Close then commits
+// the temporary file by flushing it to stable storage and
+// renaming it over the destination, so that readers of the
+// destination see either its old content or the complete new
+// content, never a partially written file. It is safe for
+// concurrent use.
+type AtomicWriter struct {
+	mu    sync.Mutex
+	file  string
+	perm  os.FileMode
+	f     *os.File
+	err   error
+	done  bool
+	wrote bool // whether any bytes have been written
+}
+
+// NewAtomicWriter takes a filepath, and returns an *AtomicWriter
+// which replaces file when it is closed. The file is given the
+// permissions perm, which, unlike those given to os.OpenFile,
+// are not modified by the umask.
+func NewAtomicWriter(file string, perm os.FileMode) *AtomicWriter {
+	return &AtomicWriter{file: file, perm: perm}
+}
+
+// Opened returns whether or not w has created
+// its temporary file.
+func (w *AtomicWriter) Opened() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.f != nil
+}
+
+func (w *AtomicWriter) Write(buf []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(buf) == 0 && w.f == nil {
+		// Don't create the temporary file for an empty write.
+		if w.done {
+			return 0, ErrClosed
+		}
+		return 0, w.err
+	}
+	if err := w.open(); err != nil {
+		return 0, err
+	}
+	i, err := w.f.Write(buf)
+	w.wrote = w.wrote || i > 0
+	w.fail(err)
+	return i, err
+}
+
+func (w *AtomicWriter) Seek(offset int64, whence int) (int64, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.open(); err != nil {
+		return 0, err
+	}
+	off, err := w.f.Seek(offset, whence)
+	w.fail(err)
+	return off, err
+}
+
+// fail records err, if it is the first error encountered
+// while writing, so that Close does not commit a partially
+// written file. It must be called with w.mu held.
+func (w *AtomicWriter) fail(err error) {
+	if w.err == nil {
+		w.err = err
+	}
+}
+
+// Close commits everything written to w to its destination.
+// If no bytes were ever written to w, the destination is left
+// alone, even if w was seeked.
+// If committing fails, or if any Write or Seek failed, the
+// temporary file is removed, the destination is likewise left
+// alone, and Close returns the error. After Close, Write and
+// Seek return ErrClosed, as does any subsequent call to Close.
+func (w *AtomicWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.done {
+		return ErrClosed
+	}
+	w.done = true
+	if w.f == nil {
+		return nil
+	}
+	tmp := w.f.Name()
+	if w.err != nil || !w.wrote {
+		w.f.Close()
+		os.Remove(tmp)
+		return w.err
+	}
+	err := w.f.Sync()
+	if err == nil {
+		err = w.f.Chmod(w.perm)
+	}
+	if cerr := w.f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, w.file)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return &LoadError{Op: opClose, Source: w.file, Err: err}
+	}
+	// Flush the rename itself, where the platform allows it.
+	if d, err := os.Open(filepath.Dir(w.file)); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
+
+// Abort discards everything written to w, leaving its
+// destination alone. After Abort, Write and Seek return
+// ErrClosed, as does Close. Calling Abort after Close or
+// Abort has no effect, so that it may be deferred to clean
+// up after any failure before Close.
+func (w *AtomicWriter) Abort() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.done {
+		return nil
+	}
+	w.done = true
+	if w.f == nil {
+		return nil
+	}
+	err := w.f.Close()
+	if rerr := os.Remove(w.f.Name()); err == nil {
+		err = rerr
+	}
+	return err
+}
+
+// open creates w's temporary file if it has not been
+// created yet, and returns any error encountered while
+// doing so, or while writing, now or previously. It must
+// be called with w.mu held.
+func (w *AtomicWriter) open() error {
+	if w.done {
+		return ErrClosed
+	}
+	if w.f == nil && w.err == nil {
+		dir, base := filepath.Split(w.file)
+		f, err := os.CreateTemp(dir, "."+base+".tmp-")
+		if err != nil {
+			w.err = &LoadError{Op: opOpen, Source: w.file, Err: err}
+		} else {
+			w.f = f
+		}
+	}
+	return w.err
+}
@@ -0,0 +1,141 @@
+// Copyright 2012 The Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package postpone
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// dirContents returns the names of the files in dir.
+func dirContents(t *testing.T, dir string) []string {
+	ents, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range ents {
+		names = append(names, e.Name())
+	}
+	return names
+}
+
+func TestAtomicWriter(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "out")
+	if err := ioutil.WriteFile(name, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	w := NewAtomicWriter(name, 0644)
+	if _, err := w.Write([]byte("new content")); err != nil {
+		t.Fatal(err)
+	}
+	if buf, _ := ioutil.ReadFile(name); string(buf) != "old" {
+		t.Fatalf("destination changed before Close: %q", buf)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if buf, _ := ioutil.ReadFile(name); string(buf) != "new content" {
+		t.Fatalf("destination contains %q after Close; want %q", buf, "new content")
+	}
+	if err := w.Abort(); err != nil {
+		t.Fatalf("Abort after Close returned %v", err)
+	}
+
+	w = NewAtomicWriter(name, 0644)
+	if _, err := w.Write([]byte("discarded")); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Abort(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != ErrClosed {
+		t.Fatalf("Close after Abort returned %v; want ErrClosed", err)
+	}
+	if buf, _ := ioutil.ReadFile(name); string(buf) != "new content" {
+		t.Fatalf("Abort changed destination to %q", buf)
+	}
+	if names := dirContents(t, dir); len(names) != 1 {
+		t.Fatalf("directory contains %v after Abort; want only the destination", names)
+	}
+
+	w = NewAtomicWriter(name, 0644)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if buf, _ := ioutil.ReadFile(name); string(buf) != "new content" {
+		t.Fatalf("unwritten AtomicWriter changed destination to %q", buf)
+	}
+
+	w = NewAtomicWriter(name, 0644)
+	if n, err := w.Write(nil); n != 0 || err != nil {
+		t.Fatalf("empty Write = %d, %v; want 0, nil", n, err)
+	}
+	if w.Opened() {
+		t.Fatal("empty Write created the temporary file")
+	}
+	if _, err := w.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if buf, _ := ioutil.ReadFile(name); string(buf) != "new content" {
+		t.Fatalf("AtomicWriter with empty writes changed destination to %q", buf)
+	}
+	if names := dirContents(t, dir); len(names) != 1 {
+		t.Fatalf("directory contains %v after empty writes; want only the destination", names)
+	}
+}
+
+func TestAtomicWriterFailedWrite(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "out")
+	if err := ioutil.WriteFile(name, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	w := NewAtomicWriter(name, 0644)
+	if _, err := w.Write([]byte("partial")); err != nil {
+		t.Fatal(err)
+	}
+	// Make the next write fail, as if the disk had filled up.
+	w.f.Close()
+	_, werr := w.Write([]byte(" content"))
+	if werr == nil {
+		t.Fatal("Write to closed temporary file succeeded")
+	}
+	if err := w.Close(); err != werr {
+		t.Fatalf("Close() = %v; want %v", err, werr)
+	}
+	if buf, _ := ioutil.ReadFile(name); string(buf) != "old" {
+		t.Fatalf("destination contains %q after failed Write; want %q", buf, "old")
+	}
+	if names := dirContents(t, dir); len(names) != 1 {
+		t.Fatalf("directory contains %v after failed Write; want only the destination", names)
+	}
+
+	w = NewAtomicWriter(name, 0644)
+	if _, err := w.Seek(-1, io.SeekStart); err == nil {
+		t.Fatal("Seek to negative offset succeeded")
+	}
+	if _, err := w.Write([]byte("new")); err == nil {
+		t.Fatal("Write after failed Seek succeeded")
+	}
+	if err := w.Close(); err == nil {
+		t.Fatal("Close after failed Seek succeeded")
+	}
+	if buf, _ := ioutil.ReadFile(name); string(buf) != "old" {
+		t.Fatalf("destination contains %q after failed Seek; want %q", buf, "old")
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright 2012 The Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package postpone
+
+import (
+	"io"
+	"math"
+	"sync"
+)
+
+// NewCachedReader takes an io.Reader and returns a *Postpone
+// which, rather than preloading all available data, reads
+// from r only as much as is needed to satisfy each Read,
+// Seek or ReadAt, caching everything read from r so that
+// it can be read again after seeking backwards. A forward
+// Seek reads and caches up to the target offset, and a
+// Seek relative to the end reads all of r.
+//
+// If r is an io.Closer, c optionally tells
+// the reader to close r when the *Postpone is closed.
+func NewCachedReader(r io.Reader, c bool) *Postpone {
+	return New(Reader(r), Cached(), CloseSource(c))
+}
+
+// minCacheRead is the smallest read cachingReader
+// makes from its underlying reader.
+const minCacheRead = 512
+
+// cachingReader is an io.ReadSeeker which reads from r
+// on demand, caching everything it reads in buf.
+type cachingReader struct {
+	mu  sync.Mutex
+	r   io.Reader
+	buf []byte
+	err error
+	off int64
+}
+
+// fill reads from cr.r until at least n bytes are cached,
+// or cr.r returns an error. It must be called with cr.mu
+// held.
+func (cr *cachingReader) fill(n int64) {
+	for int64(len(cr.buf)) < n && cr.err == nil {
+		if cap(cr.buf)-len(cr.buf) < minCacheRead {
+			buf := make([]byte, len(cr.buf), 2*cap(cr.buf)+minCacheRead)
+			copy(buf, cr.buf)
+			cr.buf = buf
+		}
+		i, err := cr.r.Read(cr.buf[len(cr.buf):cap(cr.buf)])
+		cr.buf = cr.buf[:len(cr.buf)+i]
+		cr.err = err
+	}
+}
+
+// fillErr returns the error, other than io.EOF, which
+// prevented cr from caching n bytes, if any. It must be
+// called with cr.mu held.
+func (cr *cachingReader) fillErr(n int64) error {
+	if int64(len(cr.buf)) >= n || cr.err == io.EOF {
+		return nil
+	}
+	return cr.err
+}
+
+func (cr *cachingReader) Read(buf []byte) (int, error) {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	cr.fill(cr.off + 1)
+	if cr.off >= int64(len(cr.buf)) {
+		return 0, cr.err
+	}
+	i := copy(buf, cr.buf[cr.off:])
+	cr.off += int64(i)
+	return i, nil
+}
+
+func (cr *cachingReader) ReadAt(buf []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errNegative
+	}
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	cr.fill(off + int64(len(buf)))
+	if off >= int64(len(cr.buf)) {
+		return 0, cr.err
+	}
+	i := copy(buf, cr.buf[off:])
+	if i < len(buf) {
+		return i, cr.err
+	}
+	return i, nil
+}
+
+func (cr *cachingReader) Seek(offset int64, whence int) (int64, error) {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += cr.off
+	case io.SeekEnd:
+		cr.fill(math.MaxInt64)
+		if err := cr.fillErr(math.MaxInt64); err != nil {
+			return 0, err
+		}
+		offset += int64(len(cr.buf))
+	default:
+		return 0, errWhence
+	}
+	if offset < 0 {
+		return 0, errNegative
+	}
+	cr.fill(offset)
+	if err := cr.fillErr(offset); err != nil {
+		return 0, err
+	}
+	cr.off = offset
+	return offset, nil
+}
+
+// Close closes the underlying reader, if it is an io.Closer.
+func (cr *cachingReader) Close() error {
+	if c, ok := cr.r.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
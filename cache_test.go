@@ -0,0 +1,59 @@
+// Copyright 2012 The Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package postpone
+
+import (
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+// countingReader counts the bytes read from r.
+type countingReader struct {
+	r io.Reader
+	n int
+}
+
+func (c *countingReader) Read(buf []byte) (int, error) {
+	i, err := c.r.Read(buf)
+	c.n += i
+	return i, err
+}
+
+func TestCachedReader(t *testing.T) {
+	data := strings.Repeat("0123456789", 1000)
+	src := &countingReader{r: strings.NewReader(data)}
+	p := NewCachedReader(src, false)
+
+	buf := make([]byte, 4)
+	if n, err := p.Read(buf); err != nil || string(buf[:n]) != "0123" {
+		t.Fatalf("Read = %q, %v; want %q", buf[:n], err, "0123")
+	}
+	if src.n >= len(data) {
+		t.Fatalf("first Read consumed all %d bytes of the source", src.n)
+	}
+	if _, err := p.Seek(2000, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if src.n < 2000 || src.n >= len(data) {
+		t.Fatalf("forward Seek to 2000 consumed %d bytes of the source", src.n)
+	}
+	if _, err := p.Seek(-1998, io.SeekCurrent); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := p.Read(buf); err != nil || string(buf[:n]) != "2345" {
+		t.Fatalf("Read after backward Seek = %q, %v; want %q", buf[:n], err, "2345")
+	}
+	if n, err := p.Seek(0, io.SeekEnd); err != nil || n != int64(len(data)) {
+		t.Fatalf("Seek to end = %d, %v; want %d", n, err, len(data))
+	}
+	if _, err := p.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if all, err := ioutil.ReadAll(p); err != nil || string(all) != data {
+		t.Fatalf("ReadAll = %d bytes, %v; want %d bytes", len(all), err, len(data))
+	}
+}
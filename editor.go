@@ -0,0 +1,271 @@
+// Copyright 2012 The Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package postpone
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"sync"
+)
+
+// errTooBig is returned by Write and Truncate when they
+// would make an Editor too large to hold in memory.
+var errTooBig = errors.New("postpone: too large to edit in memory")
+
+// Editor is an in-memory, editable copy of a file. It fulfills
+// the io.ReadWriteSeeker, io.ReaderAt and io.Closer interfaces.
+// Like a *Postpone created by NewFilePre, it waits to preload
+// the file until the first call to one of its methods; unlike
+// it, the preloaded content may be changed, and is written back
+// to the file by Flush and Close. It is safe for concurrent use.
+type Editor struct {
+	mu     sync.Mutex
+	file   string
+	atomic bool
+	perm   os.FileMode
+	buf    []byte
+	off    int64
+	err    error
+	loaded bool
+	dirty  bool
+	closed bool
+}
+
+// NewFileEditor takes a filepath, and returns an *Editor. If
+// atomic is set, content is written back through an
+// AtomicWriter, so that readers of the file never see a
+// partially written copy; otherwise it is written in place.
+func NewFileEditor(file string, atomic bool) *Editor {
+	return &Editor{file: file, atomic: atomic}
+}
+
+// Dirty returns whether or not e has been changed
+// since it was loaded or last written back.
+func (e *Editor) Dirty() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.dirty
+}
+
+func (e *Editor) Read(buf []byte) (int, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.load(); err != nil {
+		return 0, err
+	}
+	if e.off >= int64(len(e.buf)) {
+		return 0, io.EOF
+	}
+	i := copy(buf, e.buf[e.off:])
+	e.off += int64(i)
+	return i, nil
+}
+
+func (e *Editor) ReadAt(buf []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errNegative
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.load(); err != nil {
+		return 0, err
+	}
+	if off >= int64(len(e.buf)) {
+		return 0, io.EOF
+	}
+	i := copy(buf, e.buf[off:])
+	if i < len(buf) {
+		return i, io.EOF
+	}
+	return i, nil
+}
+
+// Write writes buf at the current offset, overwriting
+// existing content and extending e as necessary. If the
+// offset is beyond the end of e, the gap is zero-filled.
+// Write fails if e would grow too large to hold in memory.
+func (e *Editor) Write(buf []byte) (int, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.load(); err != nil {
+		return 0, err
+	}
+	if len(buf) == 0 {
+		return 0, nil
+	}
+	end := e.off + int64(len(buf))
+	if end < e.off {
+		return 0, errTooBig
+	}
+	if end > int64(len(e.buf)) {
+		if err := e.resize(end); err != nil {
+			return 0, err
+		}
+	}
+	i := copy(e.buf[e.off:], buf)
+	e.off += int64(i)
+	e.dirty = e.dirty || i > 0
+	return i, nil
+}
+
+func (e *Editor) Seek(offset int64, whence int) (int64, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.load(); err != nil {
+		return 0, err
+	}
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += e.off
+	case io.SeekEnd:
+		offset += int64(len(e.buf))
+	default:
+		return 0, errWhence
+	}
+	if offset < 0 {
+		return 0, errNegative
+	}
+	e.off = offset
+	return offset, nil
+}
+
+// Truncate changes the size of e, discarding content
+// beyond size, or zero-filling up to it. The offset
+// is not changed. Truncate fails if size is too large
+// to hold in memory.
+func (e *Editor) Truncate(size int64) error {
+	if size < 0 {
+		return errNegative
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.load(); err != nil {
+		return err
+	}
+	if size != int64(len(e.buf)) {
+		if err := e.resize(size); err != nil {
+			return err
+		}
+		e.dirty = true
+	}
+	return nil
+}
+
+// Flush writes the content of e back to its file,
+// if e is dirty.
+func (e *Editor) Flush() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.closed {
+		return ErrClosed
+	}
+	return e.flush()
+}
+
+// Close flushes e, as by Flush. After Close, all other
+// methods return ErrClosed, as does any subsequent call
+// to Close. If flushing fails, e is left open, with its
+// edits intact, so that Close may be retried.
+func (e *Editor) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.closed {
+		return ErrClosed
+	}
+	if err := e.flush(); err != nil {
+		return err
+	}
+	e.closed, e.buf = true, nil
+	return nil
+}
+
+// resize changes the size of e.buf to size, zero-filling
+// any new content, and returns errTooBig if e.buf cannot
+// be made that large. It must be called with e.mu held.
+func (e *Editor) resize(size int64) error {
+	if size > math.MaxInt {
+		return errTooBig
+	}
+	if size <= int64(cap(e.buf)) {
+		old := len(e.buf)
+		e.buf = e.buf[:size]
+		for i := old; i < len(e.buf); i++ {
+			e.buf[i] = 0
+		}
+		return nil
+	}
+	buf := makeBuf(size, 2*size)
+	if buf == nil {
+		buf = makeBuf(size, size)
+	}
+	if buf == nil {
+		return errTooBig
+	}
+	copy(buf, e.buf)
+	e.buf = buf
+	return nil
+}
+
+// makeBuf returns a buffer of length size and capacity c,
+// or nil if it is impossible to allocate.
+func makeBuf(size, c int64) (buf []byte) {
+	if c < size || c > math.MaxInt {
+		return nil
+	}
+	// make panics if the allocation is impossible.
+	defer func() { recover() }()
+	return make([]byte, size, c)
+}
+
+// load preloads e's file if it has not been loaded yet,
+// and returns any error encountered while doing so, now
+// or previously. It must be called with e.mu held.
+func (e *Editor) load() error {
+	if e.closed {
+		return ErrClosed
+	}
+	if e.loaded {
+		return e.err
+	}
+	e.loaded = true
+	fi, err := os.Stat(e.file)
+	if err != nil {
+		e.err = &LoadError{Op: opOpen, Source: e.file, Err: err}
+		return e.err
+	}
+	e.perm = fi.Mode().Perm()
+	if e.buf, err = ioutil.ReadFile(e.file); err != nil {
+		e.err = &LoadError{Op: opPreload, Source: e.file, Err: err}
+	}
+	return e.err
+}
+
+// flush writes e back to its file if it is dirty.
+// It must be called with e.mu held.
+func (e *Editor) flush() error {
+	if !e.dirty {
+		return nil
+	}
+	var err error
+	if e.atomic {
+		w := NewAtomicWriter(e.file, e.perm)
+		if _, err = w.Write(e.buf); err != nil {
+			w.Abort()
+		} else {
+			err = w.Close()
+		}
+	} else {
+		err = ioutil.WriteFile(e.file, e.buf, e.perm)
+	}
+	if err != nil {
+		return err
+	}
+	e.dirty = false
+	return nil
+}
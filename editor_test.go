@@ -0,0 +1,150 @@
+// Copyright 2012 The Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package postpone
+
+import (
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEditor(t *testing.T) {
+	for _, atomic := range []bool{false, true} {
+		name := filepath.Join(t.TempDir(), "index")
+		if err := ioutil.WriteFile(name, []byte("HDR1body"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		e := NewFileEditor(name, atomic)
+		if e.Dirty() {
+			t.Fatal("new Editor is dirty")
+		}
+		buf := make([]byte, 4)
+		if n, err := e.Read(buf); err != nil || string(buf[:n]) != "HDR1" {
+			t.Fatalf("Read = %q, %v; want %q", buf[:n], err, "HDR1")
+		}
+		if _, err := e.Seek(3, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := e.Write([]byte("2")); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := e.Seek(0, io.SeekEnd); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := e.Write([]byte("!!")); err != nil {
+			t.Fatal(err)
+		}
+		if !e.Dirty() {
+			t.Fatal("Editor not dirty after Write")
+		}
+		if buf, _ := ioutil.ReadFile(name); string(buf) != "HDR1body" {
+			t.Fatalf("file changed before Flush: %q", buf)
+		}
+		if err := e.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		if e.Dirty() {
+			t.Fatal("Editor dirty after Flush")
+		}
+		if buf, _ := ioutil.ReadFile(name); string(buf) != "HDR2body!!" {
+			t.Fatalf("file contains %q after Flush; want %q", buf, "HDR2body!!")
+		}
+
+		if err := e.Truncate(4); err != nil {
+			t.Fatal(err)
+		}
+		if err := e.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if buf, _ := ioutil.ReadFile(name); string(buf) != "HDR2" {
+			t.Fatalf("file contains %q after Close; want %q", buf, "HDR2")
+		}
+		if _, err := e.Read(buf); err != ErrClosed {
+			t.Fatalf("Read after Close returned %v; want ErrClosed", err)
+		}
+	}
+}
+
+func TestEditorEmptyWrite(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "index")
+	if err := ioutil.WriteFile(name, []byte("ab"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	e := NewFileEditor(name, false)
+	if _, err := e.Seek(10, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := e.Write(nil); n != 0 || err != nil {
+		t.Fatalf("Write(nil) = %d, %v; want 0, nil", n, err)
+	}
+	if size, err := e.Seek(0, io.SeekEnd); err != nil || size != 2 {
+		t.Fatalf("size after empty Write = %d, %v; want 2", size, err)
+	}
+	if e.Dirty() {
+		t.Fatal("Editor dirty after empty Write")
+	}
+}
+
+func TestEditorCloseRetry(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "index")
+	if err := ioutil.WriteFile(name, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	e := NewFileEditor(name, false)
+	if _, err := e.Write([]byte("new")); err != nil {
+		t.Fatal(err)
+	}
+	// Put a directory in the file's place, so that writing it back fails.
+	if err := os.Remove(name); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(name, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Close(); err == nil {
+		t.Fatal("Close succeeded writing over a directory")
+	}
+	if !e.Dirty() {
+		t.Fatal("failed Close discarded the edits")
+	}
+
+	if err := os.Remove(name); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Close(); err != nil {
+		t.Fatalf("retried Close() = %v", err)
+	}
+	if buf, _ := ioutil.ReadFile(name); string(buf) != "new" {
+		t.Fatalf("file contains %q after retried Close; want %q", buf, "new")
+	}
+}
+
+func TestEditorTooBig(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "index")
+	if err := ioutil.WriteFile(name, []byte("ab"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	e := NewFileEditor(name, false)
+	for _, off := range []int64{1 << 62, math.MaxInt64} {
+		if _, err := e.Seek(off, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := e.Write([]byte("x")); err != errTooBig {
+			t.Fatalf("Write at %d = %v; want %v", off, err, errTooBig)
+		}
+	}
+	if err := e.Truncate(1 << 62); err != errTooBig {
+		t.Fatalf("Truncate(1<<62) = %v; want %v", err, errTooBig)
+	}
+	if e.Dirty() {
+		t.Fatal("failed resize made Editor dirty")
+	}
+	if err := e.Truncate(1); err != nil {
+		t.Fatal(err)
+	}
+}
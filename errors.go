@@ -0,0 +1,74 @@
+// Copyright 2012 The Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package postpone
+
+import (
+	"errors"
+)
+
+// ErrClosed is returned by Read and Seek once
+// a *Postpone has been closed.
+var ErrClosed = errors.New("postpone: Postpone is closed")
+
+// ErrTooLarge is wrapped by the *LoadError reported when
+// the data to be preloaded exceeds the limit set by SetLimit.
+var ErrTooLarge = errors.New("postpone: preload exceeds size limit")
+
+// ErrShrunk is wrapped by the *LoadError reported when a
+// resource which was released, by a Manager or an idle timeout,
+// is reopened and found to be shorter than the offset at which
+// it was released.
+var ErrShrunk = errors.New("postpone: resource shrank below previous offset")
+
+// ErrNotReopenable is returned by Unload for a *Postpone
+// whose data cannot be read again once it has been loaded.
+var ErrNotReopenable = errors.New("postpone: resource cannot be reopened")
+
+// errNoReader is the error recorded when an input
+// function or NewReader supplies no reader and no error.
+var errNoReader = errors.New("no reader")
+
+// errWhence and errNegative are returned by seeks
+// and reads with invalid arguments.
+var (
+	errWhence   = errors.New("postpone: invalid whence")
+	errNegative = errors.New("postpone: negative position")
+)
+
+// The phases of a load reported by LoadError.Op.
+const (
+	opOpen    = "open"
+	opPreload = "preload"
+	opClose   = "close"
+	opReopen  = "reopen"
+)
+
+// LoadError records an error encountered while loading
+// a *Postpone, or opening the file of a *Writer, along
+// with the phase of the load and the resource being loaded.
+type LoadError struct {
+	// Op is the phase of the load which failed: "open",
+	// "preload", "close", or "reopen", the last being the
+	// restoring of the offset of a released resource.
+	Op string
+	// Source describes the resource being loaded, such
+	// as a file path. It is empty if nothing is known
+	// about the resource.
+	Source string
+	Err    error
+}
+
+func (e *LoadError) Error() string {
+	if e.Source == "" {
+		return "postpone: " + e.Op + ": " + e.Err.Error()
+	}
+	return "postpone: " + e.Op + " " + e.Source + ": " + e.Err.Error()
+}
+
+// Unwrap returns e.Err, so that LoadErrors work
+// with errors.Is and errors.As.
+func (e *LoadError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,68 @@
+// Copyright 2012 The Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package postpone
+
+import (
+	"time"
+)
+
+// SetIdleTimeout causes p to close its underlying resource
+// once d has passed without a call to Read, Seek or ReadAt.
+// The next such call reopens the resource and restores the
+// previous offset, failing with a *LoadError if the resource
+// can no longer be opened, or wrapping ErrShrunk if it is now
+// shorter than that offset. As with a Manager, this applies only
+// to resources opened by the input function of a *Postpone
+// created by NewFile, NewFunc, or one of their variants, with
+// c set. A d of 0 or less disables the timeout, which is the
+// default. SetIdleTimeout must be called before p is first used.
+func (p *Postpone) SetIdleTimeout(d time.Duration) {
+	p.idle = d
+}
+
+// held reports whether p holds open a resource which can be
+// released and reopened. It must be called with p.mu held.
+func (p *Postpone) held() bool {
+	return p.loaded && p.closer != nil && p.lazy && p.reopenable()
+}
+
+// touch records that p has just been used, for the benefit
+// of its idle timeout and Manager, if any. It must be called
+// without p.mu held.
+func (p *Postpone) touch() {
+	if p.manager == nil && p.idle <= 0 {
+		return
+	}
+	p.mu.Lock()
+	held := p.held()
+	if held && p.idle > 0 {
+		p.used = time.Now()
+		if p.timer == nil {
+			p.timer = time.AfterFunc(p.idle, p.expire)
+		}
+	}
+	p.mu.Unlock()
+	if p.manager != nil {
+		p.manager.use(p, held)
+	}
+}
+
+// expire releases p's resource if p has been idle for
+// its idle timeout, and otherwise checks again once it
+// might have been.
+func (p *Postpone) expire() {
+	p.mu.Lock()
+	if left := p.idle - time.Since(p.used); left > 0 && p.held() {
+		p.timer.Reset(left)
+		p.mu.Unlock()
+		return
+	}
+	p.timer = nil
+	p.release()
+	p.mu.Unlock()
+	if p.manager != nil {
+		p.manager.forget(p)
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright 2012 The Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package postpone
+
+import (
+	"errors"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// waitUnloaded waits for p to release its resource.
+func waitUnloaded(t *testing.T, p *Postpone) {
+	deadline := time.Now().Add(5 * time.Second)
+	for p.Loaded() {
+		if time.Now().After(deadline) {
+			t.Fatal("idle timeout did not release the file")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestIdleTimeout(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "file")
+	if err := ioutil.WriteFile(name, []byte("abcdef"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	p := NewFile(name)
+	p.SetIdleTimeout(5 * time.Millisecond)
+	defer p.Close()
+
+	buf := make([]byte, 2)
+	if n, err := p.Read(buf); err != nil || string(buf[:n]) != "ab" {
+		t.Fatalf("Read = %q, %v; want %q", buf[:n], err, "ab")
+	}
+	waitUnloaded(t, p)
+	if n, err := p.Read(buf); err != nil || string(buf[:n]) != "cd" {
+		t.Fatalf("Read after reopen = %q, %v; want %q", buf[:n], err, "cd")
+	}
+
+	waitUnloaded(t, p)
+	if err := ioutil.WriteFile(name, []byte("a"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Read(buf); !errors.Is(err, ErrShrunk) {
+		t.Fatalf("Read of shrunk file returned %v; want ErrShrunk", err)
+	}
+
+	p = NewFile(name)
+	p.SetIdleTimeout(5 * time.Millisecond)
+	defer p.Close()
+	if _, err := p.Read(buf); err != nil {
+		t.Fatal(err)
+	}
+	waitUnloaded(t, p)
+	if err := os.Remove(name); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Read(buf); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("Read of removed file returned %v; want fs.ErrNotExist", err)
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright 2012 The Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package postpone
+
+import (
+	"container/list"
+	"sync"
+)
+
+// A Manager limits the number of resources, such as file
+// descriptors, held open at once by the *Postpones registered
+// with it. When a registered *Postpone opens its resource and
+// the limit is exceeded, the Manager closes the resource of
+// the least-recently-used *Postpone, which is reopened, at
+// the same offset, by its next Read, Seek or ReadAt.
+//
+// Only resources opened by the input function of a
+// *Postpone created by NewFile, NewFunc, or one of their
+// variants, with c set, are counted. A Manager is safe
+// for concurrent use.
+type Manager struct {
+	mu    sync.Mutex
+	max   int
+	lru   *list.List // of *Postpone, most recently used first
+	elems map[*Postpone]*list.Element
+}
+
+// NewManager returns a Manager which allows at
+// most max resources to be held open at once.
+func NewManager(max int) *Manager {
+	return &Manager{
+		max:   max,
+		lru:   list.New(),
+		elems: make(map[*Postpone]*list.Element),
+	}
+}
+
+// Register places p under m's management. It must be
+// called before p is first used, and p must not be
+// registered with more than one Manager.
+func (m *Manager) Register(p *Postpone) {
+	p.manager = m
+}
+
+// Len returns the number of resources m
+// currently counts as open.
+func (m *Manager) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.lru.Len()
+}
+
+// use records that p has just been used, holding its
+// resource open if held is set, and closes the resources
+// of any *Postpones which take m over its limit.
+func (m *Manager) use(p *Postpone, held bool) {
+	m.mu.Lock()
+	if !held {
+		m.remove(p)
+		m.mu.Unlock()
+		return
+	}
+	if e, ok := m.elems[p]; ok {
+		m.lru.MoveToFront(e)
+	} else {
+		m.elems[p] = m.lru.PushFront(p)
+	}
+	var victims []*Postpone
+	for m.lru.Len() > m.max && m.lru.Len() > 1 {
+		victim := m.lru.Back().Value.(*Postpone)
+		m.remove(victim)
+		victims = append(victims, victim)
+	}
+	m.mu.Unlock()
+
+	// Release victims without holding m.mu, since
+	// they may be waiting for m.mu while holding
+	// their own locks.
+	for _, victim := range victims {
+		victim.mu.Lock()
+		victim.release()
+		victim.mu.Unlock()
+	}
+}
+
+// forget stops counting p's resource as open.
+func (m *Manager) forget(p *Postpone) {
+	m.mu.Lock()
+	m.remove(p)
+	m.mu.Unlock()
+}
+
+// remove must be called with m.mu held.
+func (m *Manager) remove(p *Postpone) {
+	if e, ok := m.elems[p]; ok {
+		m.lru.Remove(e)
+		delete(m.elems, p)
+	}
+}
@@ -0,0 +1,54 @@
+// Copyright 2012 The Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package postpone
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestManager(t *testing.T) {
+	dir := t.TempDir()
+	m := NewManager(2)
+	var ps []*Postpone
+	for i := 0; i < 4; i++ {
+		name := filepath.Join(dir, fmt.Sprint(i))
+		if err := ioutil.WriteFile(name, []byte(fmt.Sprintf("%d%d%d", i, i, i)), 0666); err != nil {
+			t.Fatal(err)
+		}
+		p := NewFile(name)
+		m.Register(p)
+		ps = append(ps, p)
+	}
+
+	buf := make([]byte, 1)
+	for round := 0; round < 3; round++ {
+		for i, p := range ps {
+			n, err := p.Read(buf)
+			if err != nil || n != 1 || buf[0] != byte('0'+i) {
+				t.Fatalf("round %d: Read from file %d = %q, %v", round, i, buf[:n], err)
+			}
+			if l := m.Len(); l > 2 {
+				t.Fatalf("round %d: %d files open; want at most 2", round, l)
+			}
+		}
+	}
+	if ps[0].Loaded() {
+		t.Fatal("least recently used file still open")
+	}
+	for i, p := range ps {
+		if rest, err := ioutil.ReadAll(p); err != nil || len(rest) != 0 {
+			t.Fatalf("file %d: ReadAll after reopen = %q, %v; want empty", i, rest, err)
+		}
+		if err := p.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if l := m.Len(); l != 0 {
+		t.Fatalf("%d files open after Close; want 0", l)
+	}
+}
@@ -0,0 +1,23 @@
+// Copyright 2012 The Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package postpone
+
+// NewFileMmap takes a filepath, and returns a *Postpone.
+// Like NewFilePre, this *Postpone will wait to open the file
+// until the first call to Read or Seek. Rather than copying
+// the file into memory, however, it maps the file read-only
+// into memory where the platform supports it, and serves
+// Read, Seek and ReadAt from the mapping. The mapping is
+// released when the *Postpone is closed.
+//
+// Files which cannot be mapped, such as empty files and
+// special files, and files on platforms other than Linux,
+// are read normally, as by NewFile.
+//
+// As with any memory mapping, the file should not be
+// truncated while it is mapped.
+func NewFileMmap(file string) *Postpone {
+	return New(File(file), Mmap())
+}
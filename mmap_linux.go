@@ -0,0 +1,59 @@
+// Copyright 2012 The Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package postpone
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"syscall"
+)
+
+// mmapReader serves reads from a read-only memory mapping.
+type mmapReader struct {
+	*bytes.Reader
+	data []byte
+	fi   os.FileInfo
+}
+
+// openMmap maps file into memory, or returns the
+// opened *os.File itself if it cannot be mapped.
+func openMmap(file string) (io.ReadSeeker, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	size := fi.Size()
+	if !fi.Mode().IsRegular() || size <= 0 || size != int64(int(size)) {
+		return f, nil
+	}
+	data, err := syscall.Mmap(int(f.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return f, nil
+	}
+	f.Close()
+	return &mmapReader{bytes.NewReader(data), data, fi}, nil
+}
+
+// Stat returns the os.FileInfo of the mapped file,
+// as of when it was mapped.
+func (m *mmapReader) Stat() (os.FileInfo, error) {
+	return m.fi, nil
+}
+
+// Close unmaps the memory mapping.
+func (m *mmapReader) Close() error {
+	if m.data == nil {
+		return nil
+	}
+	err := syscall.Munmap(m.data)
+	m.Reader, m.data = nil, nil
+	return err
+}
@@ -0,0 +1,22 @@
+// Copyright 2012 The Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !linux
+
+package postpone
+
+import (
+	"io"
+	"os"
+)
+
+// openMmap opens file for normal reads, since
+// memory mapping is only supported on Linux.
+func openMmap(file string) (io.ReadSeeker, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
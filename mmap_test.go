@@ -0,0 +1,35 @@
+// Copyright 2012 The Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package postpone
+
+import (
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestNewFileMmap(t *testing.T) {
+	dir := t.TempDir()
+	for _, data := range []string{"mapped data", ""} {
+		name := filepath.Join(dir, "file")
+		if err := ioutil.WriteFile(name, []byte(data), 0666); err != nil {
+			t.Fatal(err)
+		}
+		p := NewFileMmap(name)
+		if buf, err := ioutil.ReadAll(p); err != nil || string(buf) != data {
+			t.Fatalf("ReadAll = %q, %v; want %q", buf, err, data)
+		}
+		if n, err := p.Seek(0, io.SeekEnd); err != nil || n != int64(len(data)) {
+			t.Fatalf("Seek to end = %d, %v; want %d", n, err, len(data))
+		}
+		if err := p.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := p.Read(make([]byte, 1)); err != ErrClosed {
+			t.Fatalf("Read after Close returned %v; want ErrClosed", err)
+		}
+	}
+}
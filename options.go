@@ -0,0 +1,161 @@
+// Copyright 2012 The Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package postpone
+
+import (
+	"time"
+)
+
+// New returns a *Postpone which reads from source, as
+// configured by opts. Without options, a *Postpone reads
+// from a File or Func Source lazily, as do NewFile and
+// NewFunc, and preloads a ReaderFunc or Reader Source, as
+// do NewFuncPre and NewReader. Other Sources are read from
+// lazily if the reader returned by Open can seek, and are
+// otherwise preloaded.
+func New(source Source, opts ...Option) *Postpone {
+	p := &Postpone{src: source, name: source.String(), c: true}
+	switch source.(type) {
+	case funcSource, readerFuncSource, *readerSource:
+		// The caller supplied the resource, and may still need it.
+		p.c = false
+	}
+	o := options{p: p}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if o.mode == modeMmap {
+		if fs, ok := source.(*fileSource); ok {
+			p.src = &fileSource{file: fs.file, mmap: true}
+		} else {
+			o.mode = modeDefault
+		}
+	}
+	if o.mode == modeDefault {
+		switch source.(type) {
+		case readerFuncSource, *readerSource:
+			o.mode = modePreload
+		}
+	}
+	p.mode = o.mode
+	return p
+}
+
+// An Option configures a *Postpone created by New.
+type Option func(*options)
+
+type options struct {
+	p    *Postpone
+	mode mode
+}
+
+// mode is the way in which a *Postpone reads from its Source.
+type mode int
+
+const (
+	modeDefault mode = iota
+	modePreload
+	modeMmap
+	modeCached
+)
+
+// Preload causes the Source to be preloaded into an internal
+// buffer, as by NewFilePre, even if it can seek.
+func Preload() Option {
+	return func(o *options) { o.mode = modePreload }
+}
+
+// Mmap causes a File Source to be mapped into memory,
+// as by NewFileMmap. It has no effect on other Sources.
+func Mmap() Option {
+	return func(o *options) { o.mode = modeMmap }
+}
+
+// Cached causes the Source to be read from only as needed,
+// caching what has been read, as by NewCachedReader. It is
+// chiefly useful for ReaderFunc and Reader Sources, which
+// would otherwise be preloaded.
+func Cached() Option {
+	return func(o *options) { o.mode = modeCached }
+}
+
+// Progressive causes the Source to be preloaded in the
+// background, as described under SetProgressive.
+func Progressive() Option {
+	return func(o *options) { o.p.SetProgressive(true) }
+}
+
+// CloseSource sets whether the resource opened by the Source,
+// if it is an io.Closer, is closed once it has been preloaded,
+// or when the *Postpone is closed. This is the c argument of
+// the other constructors. It defaults to false for a Func,
+// ReaderFunc, or Reader Source, and to true otherwise, so that
+// resources opened by a File Source or a Source implemented
+// outside this package, such as network connections, are not
+// leaked.
+func CloseSource(c bool) Option {
+	return func(o *options) { o.p.c = c }
+}
+
+// Name sets the description of the Source reported by
+// LoadError. It defaults to the result of the Source's
+// String method.
+func Name(name string) Option {
+	return func(o *options) { o.p.name = name }
+}
+
+// Limit sets the maximum number of bytes to preload,
+// as by SetLimit.
+func Limit(n int64) Option {
+	return func(o *options) { o.p.SetLimit(n) }
+}
+
+// Spill causes preloading to spill to a temporary
+// file, as by SetSpill.
+func Spill(threshold int64, dir string) Option {
+	return func(o *options) { o.p.SetSpill(threshold, dir) }
+}
+
+// Partial sets the policy for errors encountered
+// partway through preloading, as by SetPreloadPolicy.
+func Partial(pp PreloadPolicy) Option {
+	return func(o *options) { o.p.SetPreloadPolicy(pp) }
+}
+
+// Retry sets the policy for failures to open
+// the Source, as by SetRetryPolicy.
+func Retry(rp RetryPolicy) Option {
+	return func(o *options) { o.p.SetRetryPolicy(rp) }
+}
+
+// IdleTimeout sets the idle timeout, as by SetIdleTimeout.
+func IdleTimeout(d time.Duration) Option {
+	return func(o *options) { o.p.SetIdleTimeout(d) }
+}
+
+// Managed registers the *Postpone with m.
+func Managed(m *Manager) Option {
+	return func(o *options) { m.Register(o.p) }
+}
+
+// AutoRefresh sets how often a StatSource, such as a File
+// Source, is checked for changes by Read, as by SetAutoRefresh.
+func AutoRefresh(every time.Duration) Option {
+	return func(o *options) { o.p.SetAutoRefresh(every) }
+}
+
+// SizeHint sets the size of the Source, as by SetSizeHint.
+func SizeHint(size int64) Option {
+	return func(o *options) { o.p.SetSizeHint(size) }
+}
+
+// OnLoad sets a function to be called, without any lock held,
+// whenever a load of the *Postpone finishes, with the error
+// encountered, if any. It is also called for reloads, such as
+// those following Unload or a Manager's release of the Source.
+func OnLoad(fn func(err error)) Option {
+	return func(o *options) { o.p.onLoad = fn }
+}
@@ -0,0 +1,71 @@
+// Copyright 2012 The Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package postpone
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "file")
+	if err := ioutil.WriteFile(name, []byte("contents"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	var loads []error
+	p := New(File(name), Preload(), OnLoad(func(err error) {
+		loads = append(loads, err)
+	}))
+	if buf, err := ioutil.ReadAll(p); err != nil || string(buf) != "contents" {
+		t.Fatalf("ReadAll = %q, %v; want %q", buf, err, "contents")
+	}
+	if len(loads) != 1 || loads[0] != nil {
+		t.Fatalf("OnLoad called with %v; want one nil error", loads)
+	}
+
+	p = New(File(name), Limit(4), Preload(), Name("config"))
+	var le *LoadError
+	if err := p.Load(); !errors.As(err, &le) || le.Source != "config" || !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("Load returned %v; want *LoadError for config wrapping ErrTooLarge", err)
+	}
+
+	var opens int
+	src := ReaderFunc(func(context.Context) (io.Reader, error) {
+		opens++
+		return strings.NewReader("0123456789"), nil
+	})
+	p = New(src, Cached())
+	if _, err := p.Seek(-3, io.SeekEnd); err != nil {
+		t.Fatal(err)
+	}
+	if rest, err := ioutil.ReadAll(p); err != nil || string(rest) != "789" {
+		t.Fatalf("ReadAll = %q, %v; want %q", rest, err, "789")
+	}
+	if err := p.Unload(); err != nil {
+		t.Fatalf("Unload of cached ReaderFunc returned %v", err)
+	}
+	if _, err := p.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if buf, err := ioutil.ReadAll(p); err != nil || string(buf) != "0123456789" || opens != 2 {
+		t.Fatalf("ReadAll after Unload = %q, %v after %d opens", buf, err, opens)
+	}
+
+	// Mmap has no effect on a ReaderFunc Source, which is
+	// preloaded even if its reader can seek.
+	p = New(src, Mmap())
+	if err := p.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if p.lazy {
+		t.Fatal("Mmap caused a ReaderFunc Source to be read from lazily")
+	}
+}
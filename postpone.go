@@ -8,36 +8,72 @@
 package postpone
 
 import (
-	"bytes"
+	"context"
 	"github.com/joshlf13/errlist"
 	"io"
-	"io/ioutil"
 	"os"
+	"sync"
+	"time"
 )
 
-// Postpone fulfills the io.ReadSeeker interface.
+// Postpone fulfills the io.ReadSeekCloser and io.ReaderAt interfaces.
+// It is safe for concurrent use; the underlying resource
+// is loaded exactly once, with concurrent callers waiting
+// for that load to finish.
 type Postpone struct {
-	r      io.Reader
+	mu     sync.RWMutex
+	src    Source
+	mode   mode
 	rs     io.ReadSeeker
-	getr   func() (io.Reader, error)
-	getrs  func() (io.ReadSeeker, error)
+	closer io.Closer
 	err    error
 	loaded bool
 	c      bool
 	bad    bool
+	closed bool
+	lazy   bool // whether rs was opened by src, rather than preloaded
+	name   string
+	info   os.FileInfo // of the resource, as of the last load
+
+	hint    int64 // size reported by Stat before loading
+	hasHint bool
+
+	quiet  bool
+	retry  *RetryPolicy
+	policy PreloadPolicy
+	limit  int64
+	spill  int64
+	tmpdir string
+
+	progressive bool
+	wakeMu      sync.Mutex         // guards wake, so that Close need not wait for mu
+	wake        *progressiveReader // rs, if it is being preloaded progressively
+	manager     *Manager
+	idle        time.Duration
+	timer       *time.Timer // fires once p may have been idle for idle
+	used        time.Time   // when p was last used
+
+	refreshMu    sync.Mutex // serializes calls to refresh
+	refreshEvery time.Duration
+	checked      time.Time // when p was last checked for staleness
+
+	offset   int64 // offset to restore on the next load
+	restore  bool  // whether offset should be restored
+	released bool  // whether offset was remembered by release
+
+	onLoad func(error)
+
+	loading  chan struct{}      // closed when an in-progress load finishes
+	cancel   context.CancelFunc // aborts an in-progress load
+	closeCtx context.CancelFunc // cancels the context rs was opened with
 }
 
 // NewFile takes a filepath, and returns a *Postpone.
 // This *Postpone will wait to open the file until the
-// first call to either Read or Seek.
+// first call to either Read or Seek. The file is closed
+// when the *Postpone is closed.
 func NewFile(file string) *Postpone {
-	return NewFunc(func() (io.ReadSeeker, error) {
-		f, err := os.Open(file)
-		if err != nil {
-			return nil, err
-		}
-		return f, nil
-	}, false)
+	return New(File(file))
 }
 
 // NewFilePre takes a filepath, and returns a *Postpone.
@@ -47,13 +83,7 @@ func NewFile(file string) *Postpone {
 // will be read into an internal buffer, and the file
 // will be closed.
 func NewFilePre(file string) *Postpone {
-	return NewFuncPre(func() (io.Reader, error) {
-		f, err := os.Open(file)
-		if err != nil {
-			return nil, err
-		}
-		return f, nil
-	}, true)
+	return New(File(file), Preload())
 }
 
 // NewFunc takes a function, r. This function returns an
@@ -67,10 +97,19 @@ func NewFilePre(file string) *Postpone {
 // actually needed.
 //
 // If r returns an io.Closer, c optionally tells
-// the reader to close the io.Closer once it's been
-// read from.
+// the reader to close the io.Closer when the
+// *Postpone is closed.
 func NewFunc(r func() (io.ReadSeeker, error), c bool) *Postpone {
-	return &Postpone{nil, nil, nil, r, nil, false, c, false}
+	return NewFuncContext(func(context.Context) (io.ReadSeeker, error) {
+		return r()
+	}, c)
+}
+
+// NewFuncContext is identical to NewFunc except its
+// input function takes a context.Context, which is
+// done if the load is aborted. See LoadContext.
+func NewFuncContext(r func(context.Context) (io.ReadSeeker, error), c bool) *Postpone {
+	return New(Func(r), CloseSource(c))
 }
 
 // NewFuncPre is identical to NewFunc except its input
@@ -83,7 +122,17 @@ func NewFunc(r func() (io.ReadSeeker, error), c bool) *Postpone {
 // the reader to close the io.Closer once it's been
 // read from.
 func NewFuncPre(r func() (io.Reader, error), c bool) *Postpone {
-	return &Postpone{nil, nil, r, nil, nil, false, c, false}
+	return NewFuncPreContext(func(context.Context) (io.Reader, error) {
+		return r()
+	}, c)
+}
+
+// NewFuncPreContext is identical to NewFuncPre except
+// its input function takes a context.Context, which is
+// done if the load is aborted. The preload itself is also
+// aborted if the load is. See LoadContext.
+func NewFuncPreContext(r func(context.Context) (io.Reader, error), c bool) *Postpone {
+	return New(ReaderFunc(r), CloseSource(c))
 }
 
 // NewReader takes an io.Reader and, upon the first
@@ -91,84 +140,567 @@ func NewFuncPre(r func() (io.Reader, error), c bool) *Postpone {
 // into an internal buffer.
 //
 // If r is an io.Closer, c optionally tells
-// the reader to close r once it's been read from.
+// the reader to close r once it's been read from,
+// or when the *Postpone is closed if that happens first.
 func NewReader(r io.Reader, c bool) *Postpone {
-	return &Postpone{r, nil, nil, nil, nil, false, c, false}
+	return New(Reader(r), CloseSource(c))
 }
 
 // Load performs the same operation which would
 // normally be performed during the first call
-// to Read or Seek
-func (p *Postpone) Load() {
-	p.retreive()
+// to Read or Seek, and returns any error encountered
+// while doing so. It has no effect once p has been
+// loaded.
+func (p *Postpone) Load() error {
+	return p.LoadContext(context.Background())
+}
+
+// LoadContext is like Load, but gives up once ctx is done.
+// If ctx is done while the underlying resource is being
+// opened or preloaded, that work is aborted, and p is left
+// in a failed state whose error is reported by Read and Seek.
+// If another call is already loading p, LoadContext waits
+// for it to finish, returning early without affecting p
+// if ctx is done first. A resource which is read from lazily,
+// rather than preloaded, is opened with a context derived from
+// ctx, and so may stop working once ctx is done; the context is
+// otherwise canceled only once the resource is closed.
+func (p *Postpone) LoadContext(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.load(ctx)
 }
 
-// Loaded returns whether or not Load, Read,
-// or Seek has been called yet.
+// Err returns the error encountered while loading p, if
+// any, without reading from it. It returns nil if p has
+// not been loaded yet. The error is usually a *LoadError.
+func (p *Postpone) Err() error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.err
+}
+
+// Unload releases the resource underlying p, or the buffer
+// into which it was preloaded, and returns p to its unloaded
+// state, so that the next Read, Seek or ReadAt loads it again
+// by calling its input function. The current offset is
+// remembered, and restored by that load. If p failed to load,
+// Unload clears the failure, so that the load is attempted
+// again. Unload has no effect if p has not been loaded.
+//
+// If p was created by NewReader or NewCachedReader, whose
+// data cannot be read again, Unload returns ErrNotReopenable.
+func (p *Postpone) Unload() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return ErrClosed
+	}
+	if !p.reopenable() {
+		p.mu.Unlock()
+		return ErrNotReopenable
+	}
+	err := p.release()
+	p.mu.Unlock()
+	if p.manager != nil {
+		p.manager.forget(p)
+	}
+	return err
+}
+
+// Prefetch starts loading p in the background and
+// returns immediately, so that the work of opening
+// and preloading overlaps with whatever the caller
+// does next. The first Read or Seek then waits only
+// for whatever part of the load remains, and reports
+// any error encountered.
+func (p *Postpone) Prefetch() {
+	go p.Load()
+}
+
+// Loaded returns whether or not p has been loaded,
+// by Load, Read, Seek or ReadAt, and not since
+// unloaded or released.
 func (p *Postpone) Loaded() bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
 	return p.loaded
 }
 
+// Close releases the resource underlying p. If that resource
+// is an io.Closer and c was set when p was created, it is
+// closed. If nothing has been opened yet, Close does nothing
+// other than prevent p from ever being loaded. A load which
+// is in progress is aborted.
+//
+// After Close, Read and Seek return ErrClosed, as does
+// any subsequent call to Close.
+func (p *Postpone) Close() error {
+	// A Read or Seek may hold p.mu while waiting for a
+	// progressive preload, so stop it first.
+	p.interrupt()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return ErrClosed
+	}
+	p.closed = true
+	if p.cancel != nil {
+		p.cancel()
+		return nil
+	}
+	var err error
+	if p.loaded {
+		if p.closer != nil {
+			err = p.closer.Close()
+		}
+	} else if rs, ok := p.src.(*readerSource); ok && p.c {
+		// The reader was opened by the caller.
+		if c, ok := rs.r.(io.Closer); ok {
+			err = c.Close()
+		}
+	}
+	p.cancelOpen()
+	p.rs, p.closer = nil, nil
+	p.setWake(nil)
+	if p.timer != nil {
+		p.timer.Stop()
+		p.timer = nil
+	}
+	if p.manager != nil {
+		p.manager.forget(p)
+	}
+	return err
+}
+
 func (p *Postpone) Read(buf []byte) (int, error) {
-	if !p.loaded {
-		p.retreive()
+	p.autoRefresh()
+	defer p.touch()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.load(context.Background())
+	if p.closed {
+		return 0, ErrClosed
 	}
 	if p.bad {
 		return 0, p.err
 	}
 	i, err := p.rs.Read(buf)
-	return i, errlist.NewError(err).AddError(p.err).Err()
+	return i, errlist.NewError(err).AddError(p.attached()).Err()
 }
 
+// Seek fulfills the io.Seeker interface. If p has not been
+// loaded, a seek relative to the start or the current offset
+// does not load p, but only records the new offset, which is
+// applied by the first Read. The same goes for a seek relative
+// to the end, if the size of the resource underlying p is
+// known without loading it, as described under Stat.
 func (p *Postpone) Seek(offset int64, whence int) (int64, error) {
-	if !p.loaded {
-		p.retreive()
+	defer p.touch()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.loaded && p.loading == nil && !p.closed {
+		if off, ok, err := p.deferSeek(offset, whence); ok {
+			return off, err
+		}
+	}
+	p.load(context.Background())
+	if p.closed {
+		return 0, ErrClosed
 	}
 	if p.bad {
 		return 0, p.err
 	}
 	i, err := p.rs.Seek(offset, whence)
-	return i, errlist.NewError(err).AddError(p.err).Err()
-}
-
-func (p *Postpone) retreive() {
-	if p.getrs != nil {
-		p.rs, p.err = p.getrs()
-		p.getrs = nil
-		if p.rs == nil {
-			p.bad = true
-		}
-	} else if p.getr != nil {
-		var r io.Reader
-		r, p.err = p.getr()
-		p.getr = nil
-		if r == nil || p.err != nil {
-			p.bad = true
-		} else {
-			buf, err := ioutil.ReadAll(r)
-			p.err = err
-			p.rs = bytes.NewReader(buf)
-		}
-		if p.c {
-			c, ok := r.(io.Closer)
-			if ok {
-				c.Close()
+	return i, errlist.NewError(err).AddError(p.attached()).Err()
+}
+
+// deferSeek records the offset resulting from a seek on
+// unloaded p, to be applied by the next load, if it can be
+// determined without loading p. It reports whether it could
+// be. It must be called with p.mu held.
+func (p *Postpone) deferSeek(offset int64, whence int) (int64, bool, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		if p.restore {
+			offset += p.offset
+		}
+	case io.SeekEnd:
+		if ss, ok := p.src.(StatSource); ok {
+			fi, err := ss.Stat(context.Background())
+			if err != nil {
+				return 0, false, nil
 			}
+			offset += fi.Size()
+		} else if p.hasHint {
+			offset += p.hint
+		} else {
+			return 0, false, nil
 		}
+	default:
+		return 0, true, errWhence
+	}
+	if offset < 0 {
+		return 0, true, errNegative
+	}
+	p.offset, p.restore, p.released = offset, true, false
+	return offset, true, nil
+}
+
+// ReadAt fulfills the io.ReaderAt interface, and, like Read,
+// loads p if it has not been loaded yet. If the underlying
+// resource is itself an io.ReaderAt, such as an *os.File or a
+// preloaded buffer, calls to ReadAt may proceed concurrently.
+// Otherwise, ReadAt is implemented using Seek and Read, and
+// calls are serialized with all other calls on p. In either
+// case, ReadAt does not affect the offset used by Read and Seek.
+//
+// The exception is a *Postpone whose Source is a RangeSource,
+// which ReadAt may read from through OpenRange instead, as
+// described there, without loading p; calls then likewise
+// proceed concurrently.
+func (p *Postpone) ReadAt(buf []byte, off int64) (int, error) {
+	defer p.touch()
+	p.mu.RLock()
+	if ra, ok := p.rs.(io.ReaderAt); ok && p.loaded {
+		defer p.mu.RUnlock()
+		i, err := ra.ReadAt(buf, off)
+		return i, errlist.NewError(err).AddError(p.attached()).Err()
+	}
+	p.mu.RUnlock()
+
+	p.mu.Lock()
+	if rsrc, ok := p.rangeSource(); ok {
+		attached := p.attached()
+		p.mu.Unlock()
+		i, err := readRange(rsrc, buf, off)
+		return i, errlist.NewError(err).AddError(attached).Err()
+	}
+	defer p.mu.Unlock()
+	p.load(context.Background())
+	if p.closed {
+		return 0, ErrClosed
+	}
+	if p.bad {
+		return 0, p.err
+	}
+	var i int
+	var err error
+	if ra, ok := p.rs.(io.ReaderAt); ok {
+		i, err = ra.ReadAt(buf, off)
 	} else {
-		var buf []byte
-		if p.r == nil {
-			p.bad = true
-		} else {
-			buf, p.err = ioutil.ReadAll(p.r)
-			p.rs = bytes.NewReader(buf)
-			if p.c {
-				c, ok := p.r.(io.Closer)
-				if ok {
-					c.Close()
-				}
+		i, err = readAt(p.rs, buf, off)
+	}
+	return i, errlist.NewError(err).AddError(p.attached()).Err()
+}
+
+// readAt implements io.ReaderAt semantics on top of rs,
+// restoring the original offset of rs before returning.
+func readAt(rs io.ReadSeeker, buf []byte, off int64) (int, error) {
+	cur, err := rs.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+	if _, err = rs.Seek(off, io.SeekStart); err != nil {
+		return 0, err
+	}
+	i, err := io.ReadFull(rs, buf)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	if _, serr := rs.Seek(cur, io.SeekStart); err == nil {
+		err = serr
+	}
+	return i, err
+}
+
+// rangeSource returns p's Source, if ReadAt should read from
+// it through OpenRange rather than loading p, or from the
+// loaded resource. It must be called with p.mu held.
+func (p *Postpone) rangeSource() (RangeSource, bool) {
+	rsrc, ok := p.src.(RangeSource)
+	if !ok || p.closed || p.bad {
+		return nil, false
+	}
+	if p.mode != modeDefault || p.progressive || p.limit > 0 || p.manager != nil {
+		// Reading around the way p holds its
+		// resource would defeat its purpose.
+		return nil, false
+	}
+	_, ra := p.rs.(io.ReaderAt)
+	return rsrc, !ra
+}
+
+// readRange implements io.ReaderAt semantics using
+// src.OpenRange.
+func readRange(src RangeSource, buf []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errNegative
+	}
+	r, err := src.OpenRange(context.Background(), off, int64(len(buf)))
+	if r == nil {
+		return 0, err
+	}
+	if c, ok := r.(io.Closer); ok {
+		defer c.Close()
+	}
+	i, err := io.ReadFull(r, buf)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return i, err
+}
+
+// load loads p if it has not been loaded yet, and returns
+// any error encountered while doing so. If another call is
+// already loading p, load waits for it to finish instead.
+// It must be called with p.mu held for writing, and releases
+// it while waiting or loading.
+func (p *Postpone) load(ctx context.Context) error {
+	for !p.loaded && !p.closed {
+		if p.loading != nil {
+			done := p.loading
+			p.mu.Unlock()
+			select {
+			case <-done:
+			case <-ctx.Done():
+				p.mu.Lock()
+				return ctx.Err()
 			}
+			p.mu.Lock()
+			if p.bad {
+				// The load we waited for failed, but p
+				// is to be reopened by a later load.
+				break
+			}
+			continue
+		}
+		done := make(chan struct{})
+		// The resource may be bound to the context it is opened
+		// with, as is an HTTP response body, so the context is
+		// only canceled once the resource has been closed.
+		ctx, cancel := context.WithCancel(ctx)
+		p.loading, p.cancel = done, cancel
+		p.mu.Unlock()
+		res := p.retreive(ctx)
+		res.cancel = cancel
+		if res.bad {
+			cancel()
 		}
+		if p.onLoad != nil {
+			p.onLoad(res.err)
+		}
+		p.mu.Lock()
+		p.loading, p.cancel = nil, nil
+		close(done)
+		if p.closed {
+			res.close()
+			break
+		}
+		if p.restore && !res.bad {
+			res = p.seekTo(res, p.offset, p.released)
+		}
+		p.rs, p.err, p.bad, p.loaded = res.rs, res.err, res.bad, !res.reopen
+		p.setWake(p.rs)
+		p.quiet, p.closer, p.closeCtx = res.quiet, res.closer, res.cancel
+		p.info, p.checked, p.lazy = res.info, time.Now(), res.lazy
+		p.restore = p.restore && res.bad
+		break
+	}
+	if p.closed {
+		return ErrClosed
+	}
+	return p.err
+}
+
+// release closes the resource underlying p, if it has been
+// loaded and can be loaded again, and returns p to its
+// unloaded state. The current offset is remembered, and
+// restored by the next load. It must be called with p.mu
+// held for writing.
+func (p *Postpone) release() error {
+	if !p.loaded || p.closed || !p.reopenable() {
+		return nil
+	}
+	var err error
+	if !p.bad {
+		var off int64
+		if off, err = p.rs.Seek(0, io.SeekCurrent); err != nil {
+			return err
+		}
+		p.offset, p.restore, p.released = off, true, true
+	}
+	if p.closer != nil {
+		err = p.closer.Close()
+	}
+	p.cancelOpen()
+	p.rs, p.closer, p.err, p.quiet = nil, nil, nil, false
+	p.setWake(nil)
+	p.bad, p.loaded = false, false
+	return err
+}
+
+// reopenable reports whether the resource underlying
+// p can be opened again once it has been released.
+func (p *Postpone) reopenable() bool {
+	_, once := p.src.(*readerSource)
+	return !once
+}
+
+// seekTo seeks the newly loaded res to off, and returns res,
+// or a failed result on error. If released is set, off was
+// remembered by release, and it is an error for res to be
+// shorter than off.
+func (p *Postpone) seekTo(res result, off int64, released bool) result {
+	var err error
+	if released {
+		var size int64
+		size, err = res.rs.Seek(0, io.SeekEnd)
+		if err == nil && size < off {
+			err = ErrShrunk
+		}
+	}
+	if err == nil {
+		_, err = res.rs.Seek(off, io.SeekStart)
+	}
+	if err != nil {
+		res.close()
+		return p.failed(opReopen, err)
+	}
+	return res
+}
+
+// result is the outcome of a call to retreive.
+type result struct {
+	rs  io.ReadSeeker
+	err error
+	bad bool
+	// closer, if non-nil, is closed when p is closed.
+	closer io.Closer
+	// info describes the loaded resource, if possible.
+	info os.FileInfo
+	// lazy is set if rs was opened by the Source,
+	// rather than preloaded.
+	lazy bool
+	// quiet is set if err is reported by rs itself,
+	// rather than alongside the result of every read.
+	quiet bool
+	// reopen is set if the load failed, but should
+	// be attempted again by the next load.
+	reopen bool
+	// cancel, if non-nil, cancels the context
+	// with which rs was opened.
+	cancel context.CancelFunc
+}
+
+// close closes res.closer, if any.
+func (res result) close() {
+	if res.closer != nil {
+		res.closer.Close()
+	}
+	if res.cancel != nil {
+		res.cancel()
+	}
+}
+
+// cancelOpen cancels the context with which the resource
+// underlying p was opened, once that resource has been
+// closed. It must be called with p.mu held for writing.
+func (p *Postpone) cancelOpen() {
+	if p.closeCtx != nil {
+		p.closeCtx()
+		p.closeCtx = nil
+	}
+}
+
+// retreive opens and, if necessary, preloads the resource
+// underlying p. It is called without p.mu held, and only
+// uses fields which do not change after p is first used.
+func (p *Postpone) retreive(ctx context.Context) result {
+	var r io.Reader
+	err := p.retry.do(ctx, func() (ok bool, err error) {
+		r, err = p.src.Open(ctx)
+		return r != nil, err
+	})
+	if r == nil {
+		return p.failed(opOpen, err)
+	}
+	info := p.statOf(ctx, r)
+	rs, lazy := r.(io.ReadSeeker)
+	switch p.mode {
+	case modeCached:
+		rs, lazy = &cachingReader{r: r}, true
+	case modePreload:
+		lazy = false
+	}
+	if lazy {
+		res := result{rs: rs, err: p.loadError(opOpen, err), info: info, lazy: true}
+		if c, ok := rs.(io.Closer); ok && p.c {
+			res.closer = c
+		}
+		return res
+	}
+	if err != nil {
+		if c, ok := r.(io.Closer); ok && p.c {
+			c.Close()
+		}
+		return p.failed(opOpen, err)
+	}
+	if p.progressive {
+		res := p.preloadProgressive(ctx, r)
+		res.info = info
+		return res
+	}
+	res := p.preload(ctx, r)
+	res.info = info
+	if c, ok := r.(io.Closer); ok && p.c {
+		if err := c.Close(); err != nil && res.err == nil && !res.bad {
+			res.err = p.loadError(opClose, err)
+		}
+	}
+	return res
+}
+
+// attached returns the error to be reported alongside
+// the result of every read from p. It must be called
+// with p.mu held.
+func (p *Postpone) attached() error {
+	if p.quiet {
+		return nil
+	}
+	return p.err
+}
+
+// statOf returns the os.FileInfo describing the newly opened
+// r, or failing that, as reported by p's Source, if possible.
+func (p *Postpone) statOf(ctx context.Context, r io.Reader) os.FileInfo {
+	if fi := statOf(r); fi != nil {
+		return fi
+	}
+	if ss, ok := p.src.(StatSource); ok {
+		if fi, err := ss.Stat(ctx); err == nil {
+			return fi
+		}
+	}
+	return nil
+}
+
+// failed returns the result of a load which failed
+// during op with err, which may be nil.
+func (p *Postpone) failed(op string, err error) result {
+	reopen := p.retry.reopen(err)
+	if err == nil {
+		err = errNoReader
+	}
+	return result{err: p.loadError(op, err), bad: true, reopen: reopen}
+}
+
+// loadError wraps a non-nil err in a *LoadError
+// describing p.
+func (p *Postpone) loadError(op string, err error) error {
+	if err == nil {
+		return nil
 	}
-	p.loaded = true
+	return &LoadError{Op: op, Source: p.name, Err: err}
 }
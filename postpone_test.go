@@ -0,0 +1,285 @@
+// Copyright 2012 The Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package postpone
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestConcurrentLoad(t *testing.T) {
+	data := []byte("concurrent")
+	var opens int32
+	p := NewFunc(func() (io.ReadSeeker, error) {
+		atomic.AddInt32(&opens, 1)
+		return bytes.NewReader(data), nil
+	}, false)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			switch i % 3 {
+			case 0:
+				p.Read(make([]byte, 1))
+			case 1:
+				p.Seek(0, io.SeekStart)
+			case 2:
+				p.Load()
+			}
+			p.Loaded()
+		}(i)
+	}
+	wg.Wait()
+
+	if n := atomic.LoadInt32(&opens); n != 1 {
+		t.Fatalf("opener called %d times; want 1", n)
+	}
+	if !p.Loaded() {
+		t.Fatal("Loaded() = false after concurrent access")
+	}
+	if _, err := p.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	buf, err := ioutil.ReadAll(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf, data) {
+		t.Fatalf("read %q; want %q", buf, data)
+	}
+}
+
+func TestClose(t *testing.T) {
+	p := NewReader(bytes.NewReader([]byte("data")), false)
+	if err := p.Close(); err != nil {
+		t.Fatalf("Close() on unloaded Postpone: %v", err)
+	}
+	if _, err := p.Read(make([]byte, 1)); err != ErrClosed {
+		t.Fatalf("Read after Close returned %v; want ErrClosed", err)
+	}
+	if _, err := p.Seek(0, io.SeekStart); err != ErrClosed {
+		t.Fatalf("Seek after Close returned %v; want ErrClosed", err)
+	}
+	if p.Loaded() {
+		t.Fatal("Close loaded the Postpone")
+	}
+}
+
+// closeRecorder counts calls to Close.
+type closeRecorder struct {
+	io.ReadSeeker
+	closes int
+}
+
+func (c *closeRecorder) Close() error {
+	c.closes++
+	return nil
+}
+
+func TestCloseSource(t *testing.T) {
+	for _, c := range []bool{true, false} {
+		rec := &closeRecorder{ReadSeeker: bytes.NewReader([]byte("data"))}
+		p := NewFunc(func() (io.ReadSeeker, error) { return rec, nil }, c)
+		if _, err := p.Read(make([]byte, 1)); err != nil {
+			t.Fatal(err)
+		}
+		if err := p.Close(); err != nil {
+			t.Fatalf("Close() = %v", err)
+		}
+		want := 0
+		if c {
+			want = 1
+		}
+		if rec.closes != want {
+			t.Fatalf("NewFunc(..., %v): source closed %d times; want %d", c, rec.closes, want)
+		}
+	}
+
+	name := filepath.Join(t.TempDir(), "file")
+	if err := ioutil.WriteFile(name, []byte("data"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	var f *os.File
+	p := NewFunc(func() (io.ReadSeeker, error) {
+		var err error
+		f, err = os.Open(name)
+		return f, err
+	}, true)
+	if _, err := p.Read(make([]byte, 1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Close(); err != nil {
+		t.Fatalf("Close() = %v", err)
+	}
+	if _, err := f.Read(make([]byte, 1)); !errors.Is(err, os.ErrClosed) {
+		t.Fatalf("Read from file after Close = %v; want %v", err, os.ErrClosed)
+	}
+}
+
+// seekOnly hides any io.ReaderAt implementation of
+// the wrapped io.ReadSeeker.
+type seekOnly struct {
+	io.ReadSeeker
+}
+
+func TestReadAt(t *testing.T) {
+	data := []byte("0123456789")
+	for _, tt := range []struct {
+		name string
+		p    *Postpone
+	}{
+		{"ReaderAt", NewFunc(func() (io.ReadSeeker, error) {
+			return bytes.NewReader(data), nil
+		}, false)},
+		{"ReadSeeker", NewFunc(func() (io.ReadSeeker, error) {
+			return seekOnly{bytes.NewReader(data)}, nil
+		}, false)},
+		{"Preload", NewReader(bytes.NewBuffer(data), false)},
+	} {
+		p := tt.p
+		if _, err := p.Seek(2, io.SeekStart); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func(off int64) {
+				defer wg.Done()
+				buf := make([]byte, 2)
+				n, err := p.ReadAt(buf, off)
+				if err != nil || n != 2 || !bytes.Equal(buf, data[off:off+2]) {
+					t.Errorf("%s: ReadAt(%d) = %d, %v, %q", tt.name, off, n, err, buf[:n])
+				}
+			}(int64(i))
+		}
+		wg.Wait()
+
+		buf := make([]byte, 4)
+		n, err := p.ReadAt(buf, 8)
+		if n != 2 || err != io.EOF {
+			t.Errorf("%s: short ReadAt = %d, %v; want 2, EOF", tt.name, n, err)
+		}
+		if n, _ := p.Read(buf[:1]); n != 1 || buf[0] != '2' {
+			t.Errorf("%s: ReadAt moved the Read offset", tt.name)
+		}
+	}
+}
+
+// zeros is an endless io.Reader.
+type zeros struct{}
+
+func (zeros) Read(buf []byte) (int, error) {
+	for i := range buf {
+		buf[i] = 0
+	}
+	return len(buf), nil
+}
+
+func TestLoadContext(t *testing.T) {
+	p := NewFuncPreContext(func(ctx context.Context) (io.Reader, error) {
+		return zeros{}, nil
+	}, false)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := p.LoadContext(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("LoadContext returned %v; want DeadlineExceeded", err)
+	}
+	if _, err := p.Read(make([]byte, 1)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Read after canceled load returned %v; want DeadlineExceeded", err)
+	}
+
+	errOpen := errors.New("open failed")
+	p = NewFunc(func() (io.ReadSeeker, error) {
+		return nil, errOpen
+	}, false)
+	if err := p.Load(); !errors.Is(err, errOpen) {
+		t.Fatalf("Load returned %v; want %v", err, errOpen)
+	}
+}
+
+// ctxReader is a reader bound to the context it was opened
+// with, such as an HTTP response body.
+type ctxReader struct {
+	ctx context.Context
+	r   io.ReadSeeker
+}
+
+func (c ctxReader) Read(buf []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(buf)
+}
+
+func (c ctxReader) Seek(offset int64, whence int) (int64, error) {
+	return c.r.Seek(offset, whence)
+}
+
+func TestLoadContextBound(t *testing.T) {
+	var opened context.Context
+	p := NewFuncContext(func(ctx context.Context) (io.ReadSeeker, error) {
+		opened = ctx
+		return ctxReader{ctx, bytes.NewReader([]byte("bound"))}, nil
+	}, false)
+	if buf, err := ioutil.ReadAll(p); err != nil || string(buf) != "bound" {
+		t.Fatalf("ReadAll = %q, %v; want %q", buf, err, "bound")
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if opened.Err() == nil {
+		t.Fatal("Close did not cancel the context the resource was opened with")
+	}
+}
+
+func TestPrefetch(t *testing.T) {
+	opened := make(chan struct{})
+	p := NewFuncPre(func() (io.Reader, error) {
+		close(opened)
+		return bytes.NewBufferString("prefetched"), nil
+	}, false)
+	p.Prefetch()
+	select {
+	case <-opened:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Prefetch did not start loading")
+	}
+	buf, err := ioutil.ReadAll(p)
+	if err != nil || string(buf) != "prefetched" {
+		t.Fatalf("read %q, %v; want %q", buf, err, "prefetched")
+	}
+}
+
+func TestLoadError(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "missing")
+	p := NewFile(name)
+	if err := p.Err(); err != nil {
+		t.Fatalf("Err() before load = %v; want nil", err)
+	}
+	_, err := p.Read(make([]byte, 1))
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("Read returned %v; want fs.ErrNotExist", err)
+	}
+	var le *LoadError
+	if !errors.As(err, &le) || le.Op != "open" || le.Source != name {
+		t.Fatalf("Read returned %#v; want *LoadError for open of %s", err, name)
+	}
+	if p.Err() != err {
+		t.Fatalf("Err() = %v; want %v", p.Err(), err)
+	}
+}
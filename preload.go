@@ -0,0 +1,163 @@
+// Copyright 2012 The Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package postpone
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math"
+	"os"
+)
+
+// PreloadPolicy determines how a *Postpone handles an
+// error encountered partway through preloading.
+type PreloadPolicy int
+
+const (
+	// PreloadAttach serves the data preloaded before the
+	// error, and returns the error alongside the result
+	// of every subsequent Read, Seek and ReadAt. This is
+	// the default.
+	PreloadAttach PreloadPolicy = iota
+
+	// PreloadStrict fails the load, so that no data is
+	// served, and Read, Seek and ReadAt return the error.
+	PreloadStrict
+
+	// PreloadLenient serves the data preloaded before the
+	// error, and reports the error once, from the Read
+	// which would otherwise have returned io.EOF.
+	PreloadLenient
+)
+
+// SetPreloadPolicy sets the policy p uses when preloading
+// fails partway through. It must be called before p is
+// first used, and has no effect unless p preloads.
+func (p *Postpone) SetPreloadPolicy(pp PreloadPolicy) {
+	p.policy = pp
+}
+
+// SetLimit sets the maximum number of bytes p will preload.
+// If the resource underlying p is larger, the load fails with
+// a *LoadError wrapping ErrTooLarge, regardless of p's
+// PreloadPolicy; the data is never silently truncated.
+// A limit of 0 or less means no limit, which is the default.
+// SetLimit must be called before p is first used, and has
+// no effect unless p preloads.
+func (p *Postpone) SetLimit(n int64) {
+	p.limit = n
+}
+
+// stater is implemented by resources, such as *os.File,
+// which can describe themselves without being read.
+type stater interface {
+	Stat() (os.FileInfo, error)
+}
+
+// statOf returns the os.FileInfo describing r,
+// or nil if r cannot describe itself.
+func statOf(r io.Reader) os.FileInfo {
+	if s, ok := r.(stater); ok {
+		if fi, err := s.Stat(); err == nil {
+			return fi
+		}
+	}
+	return nil
+}
+
+// preload reads all of r into an internal buffer.
+func (p *Postpone) preload(ctx context.Context, r io.Reader) result {
+	if c, ok := r.(io.Closer); ok && p.c {
+		stop := context.AfterFunc(ctx, func() { c.Close() })
+		defer stop()
+	}
+	if p.limit > 0 {
+		if s, ok := r.(stater); ok {
+			if fi, err := s.Stat(); err == nil && fi.Mode().IsRegular() && fi.Size() > p.limit {
+				return result{err: p.loadError(opPreload, ErrTooLarge), bad: true}
+			}
+		}
+		if p.limit < math.MaxInt64 {
+			// Read one byte past the limit, to tell
+			// whether the resource exceeds it.
+			r = io.LimitReader(r, p.limit+1)
+		}
+	}
+	var rs readSeekerAt
+	var closer io.Closer
+	var size int64
+	var err error
+	if p.spill > 0 {
+		var sr *spillReader
+		sr, err = spill(ctx, r, p.spill, p.tmpdir)
+		rs, closer, size = sr, sr, sr.size
+	} else {
+		var buf []byte
+		buf, err = readAll(ctx, r)
+		rs, size = bytes.NewReader(buf), int64(len(buf))
+	}
+	fail := func(err error) result {
+		if closer != nil {
+			closer.Close()
+		}
+		return result{err: p.loadError(opPreload, err), bad: true}
+	}
+	if ctx.Err() != nil {
+		return fail(ctx.Err())
+	}
+	if p.limit > 0 && size > p.limit {
+		return fail(ErrTooLarge)
+	}
+	switch {
+	case err == nil:
+	case p.policy == PreloadStrict:
+		return fail(err)
+	case p.policy == PreloadLenient:
+		err = p.loadError(opPreload, err)
+		return result{rs: &lenientReader{rs, err}, err: err, closer: closer, quiet: true}
+	}
+	return result{rs: rs, err: p.loadError(opPreload, err), closer: closer}
+}
+
+// readSeekerAt is implemented by preloaded buffers.
+type readSeekerAt interface {
+	io.ReadSeeker
+	io.ReaderAt
+}
+
+// preloadChunk is the amount of data readAll reads
+// between checks of its context.
+const preloadChunk = 32 * 1024
+
+// readAll is like ioutil.ReadAll, but stops
+// reading once ctx is done.
+func readAll(ctx context.Context, r io.Reader) ([]byte, error) {
+	var buf bytes.Buffer
+	for {
+		if err := ctx.Err(); err != nil {
+			return buf.Bytes(), err
+		}
+		n, err := buf.ReadFrom(io.LimitReader(r, preloadChunk))
+		if err != nil || n < preloadChunk {
+			return buf.Bytes(), err
+		}
+	}
+}
+
+// lenientReader is a preloaded buffer which returns
+// err, once, in place of io.EOF.
+type lenientReader struct {
+	readSeekerAt
+	err error
+}
+
+func (l *lenientReader) Read(buf []byte) (int, error) {
+	i, err := l.readSeekerAt.Read(buf)
+	if err == io.EOF && l.err != nil {
+		err, l.err = l.err, nil
+	}
+	return i, err
+}
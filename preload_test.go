@@ -0,0 +1,137 @@
+// Copyright 2012 The Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package postpone
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var errPartial = errors.New("partial")
+
+// partialReader returns data, and then errPartial.
+func partialReader(data string) io.Reader {
+	return io.MultiReader(strings.NewReader(data), errorReader{errPartial})
+}
+
+type errorReader struct {
+	err error
+}
+
+func (e errorReader) Read([]byte) (int, error) {
+	return 0, e.err
+}
+
+func TestPreloadAttach(t *testing.T) {
+	p := NewReader(partialReader("abc"), false)
+	buf := make([]byte, 1)
+	for i := 0; i < 2; i++ {
+		if n, err := p.Read(buf); n != 1 || !errors.Is(err, errPartial) {
+			t.Fatalf("Read = %d, %v; want 1, %v", n, err, errPartial)
+		}
+	}
+	if _, err := p.Seek(0, io.SeekStart); !errors.Is(err, errPartial) {
+		t.Fatalf("Seek returned %v; want %v", err, errPartial)
+	}
+}
+
+func TestPreloadStrict(t *testing.T) {
+	p := NewReader(partialReader("abc"), false)
+	p.SetPreloadPolicy(PreloadStrict)
+	if n, err := p.Read(make([]byte, 1)); n != 0 || !errors.Is(err, errPartial) {
+		t.Fatalf("Read = %d, %v; want 0, %v", n, err, errPartial)
+	}
+	if _, err := p.ReadAt(make([]byte, 1), 0); !errors.Is(err, errPartial) {
+		t.Fatalf("ReadAt returned %v; want %v", err, errPartial)
+	}
+}
+
+func TestPreloadLenient(t *testing.T) {
+	p := NewReader(partialReader("abc"), false)
+	p.SetPreloadPolicy(PreloadLenient)
+	if _, err := p.Seek(1, io.SeekStart); err != nil {
+		t.Fatalf("Seek returned %v", err)
+	}
+	buf, err := ioutil.ReadAll(p)
+	if string(buf) != "bc" || !errors.Is(err, errPartial) {
+		t.Fatalf("ReadAll = %q, %v; want %q, %v", buf, err, "bc", errPartial)
+	}
+	if n, err := p.Read(make([]byte, 1)); n != 0 || err != io.EOF {
+		t.Fatalf("Read after error = %d, %v; want 0, EOF", n, err)
+	}
+	if !errors.Is(p.Err(), errPartial) {
+		t.Fatalf("Err() = %v; want %v", p.Err(), errPartial)
+	}
+}
+
+func TestSetLimit(t *testing.T) {
+	p := NewReader(strings.NewReader("abcd"), false)
+	p.SetLimit(4)
+	if buf, err := ioutil.ReadAll(p); err != nil || string(buf) != "abcd" {
+		t.Fatalf("ReadAll at limit = %q, %v; want %q, nil", buf, err, "abcd")
+	}
+
+	p = NewReader(strings.NewReader("abcde"), false)
+	p.SetLimit(4)
+	if n, err := p.Read(make([]byte, 1)); n != 0 || !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("Read over limit = %d, %v; want 0, ErrTooLarge", n, err)
+	}
+
+	name := filepath.Join(t.TempDir(), "large")
+	if err := ioutil.WriteFile(name, []byte("abcde"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	p = NewFilePre(name)
+	p.SetLimit(4)
+	if err := p.Load(); !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("Load of large file returned %v; want ErrTooLarge", err)
+	}
+
+	p = NewReader(strings.NewReader("abcd"), false)
+	p.SetLimit(math.MaxInt64)
+	if buf, err := ioutil.ReadAll(p); err != nil || string(buf) != "abcd" {
+		t.Fatalf("ReadAll with maximal limit = %q, %v; want %q, nil", buf, err, "abcd")
+	}
+}
+
+func TestUnload(t *testing.T) {
+	var opens int
+	p := NewFuncPre(func() (io.Reader, error) {
+		opens++
+		return strings.NewReader("abcdef"), nil
+	}, false)
+	buf := make([]byte, 2)
+	if _, err := p.Read(buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Unload(); err != nil {
+		t.Fatalf("Unload returned %v", err)
+	}
+	if p.Loaded() {
+		t.Fatal("Loaded() = true after Unload")
+	}
+	if n, err := p.Read(buf); err != nil || string(buf[:n]) != "cd" {
+		t.Fatalf("Read after Unload = %q, %v; want %q", buf[:n], err, "cd")
+	}
+	if opens != 2 {
+		t.Fatalf("input function called %d times; want 2", opens)
+	}
+
+	p = NewReader(strings.NewReader("abcdef"), false)
+	if err := p.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Unload(); err != ErrNotReopenable {
+		t.Fatalf("Unload of NewReader returned %v; want ErrNotReopenable", err)
+	}
+	if !p.Loaded() {
+		t.Fatal("refused Unload unloaded the Postpone")
+	}
+}
@@ -0,0 +1,202 @@
+// Copyright 2012 The Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package postpone
+
+import (
+	"context"
+	"io"
+	"math"
+	"sync"
+)
+
+// SetProgressive causes p to preload in the background,
+// so that the first Read or Seek waits only for the
+// underlying resource to be opened. Each Read then returns
+// whatever data has been preloaded so far, waiting only if
+// none is available. A Seek to an offset which has not been
+// preloaded yet waits for it, and a Seek relative to the end
+// waits for the preload to finish.
+//
+// An error encountered while preloading, including one
+// caused by exceeding the limit set by SetLimit, is returned
+// by every Read and ReadAt which reaches the point at which
+// it occurred. PreloadPolicy and SetSpill do not apply.
+// Close does not wait for data to arrive: any Read, Seek
+// or ReadAt still waiting for it returns ErrClosed.
+//
+// SetProgressive must be called before p is first used,
+// and has no effect unless p preloads.
+func (p *Postpone) SetProgressive(progressive bool) {
+	p.progressive = progressive
+}
+
+// progressiveReader is a buffer which is filled
+// in the background while it is being read.
+type progressiveReader struct {
+	mu   sync.Mutex
+	cond sync.Cond
+	buf  []byte
+	done bool
+	err  error
+	off  int64
+
+	cancel context.CancelFunc
+}
+
+// preloadProgressive starts preloading r in the background, and
+// returns a result whose reader serves the data as it arrives.
+func (p *Postpone) preloadProgressive(ctx context.Context, r io.Reader) result {
+	ctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	pr := &progressiveReader{cancel: cancel}
+	pr.cond.L = &pr.mu
+	go func() {
+		var err error
+		if c, ok := r.(io.Closer); ok && p.c {
+			stop := context.AfterFunc(ctx, func() { c.Close() })
+			err = pr.fill(ctx, r, p.limit)
+			stop()
+			c.Close()
+		} else {
+			err = pr.fill(ctx, r, p.limit)
+		}
+		pr.finish(p.loadError(opPreload, err))
+	}()
+	return result{rs: pr, closer: pr}
+}
+
+// setWake records rs, if it is being preloaded progressively,
+// so that Close can wake calls waiting on it. It must be called
+// with p.mu held whenever p.rs changes.
+func (p *Postpone) setWake(rs io.ReadSeeker) {
+	pr, _ := rs.(*progressiveReader)
+	p.wakeMu.Lock()
+	p.wake = pr
+	p.wakeMu.Unlock()
+}
+
+// interrupt stops any progressive preload of p, waking calls
+// waiting on it. Unlike most methods, it is called without
+// p.mu held, since those calls may hold it.
+func (p *Postpone) interrupt() {
+	p.wakeMu.Lock()
+	defer p.wakeMu.Unlock()
+	if p.wake != nil {
+		p.wake.Close()
+	}
+}
+
+// fill reads r into pr.buf until EOF, an error, or
+// ctx is done, and returns any error other than EOF.
+func (pr *progressiveReader) fill(ctx context.Context, r io.Reader, limit int64) error {
+	chunk := make([]byte, preloadChunk)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		i, err := r.Read(chunk)
+		pr.mu.Lock()
+		pr.buf = append(pr.buf, chunk[:i]...)
+		size := int64(len(pr.buf))
+		pr.cond.Broadcast()
+		pr.mu.Unlock()
+		if limit > 0 && size > limit {
+			return ErrTooLarge
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// finish marks preloading as finished with err, unless it
+// already has, and wakes any calls waiting for data.
+func (pr *progressiveReader) finish(err error) {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+	if !pr.done {
+		pr.done, pr.err = true, err
+	}
+	pr.cond.Broadcast()
+}
+
+// wait waits until at least n bytes have been
+// preloaded, or preloading has finished. It must
+// be called with pr.mu held.
+func (pr *progressiveReader) wait(n int64) {
+	for int64(len(pr.buf)) < n && !pr.done {
+		pr.cond.Wait()
+	}
+}
+
+func (pr *progressiveReader) Read(buf []byte) (int, error) {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+	pr.wait(pr.off + 1)
+	if pr.off >= int64(len(pr.buf)) {
+		return 0, pr.eof()
+	}
+	i := copy(buf, pr.buf[pr.off:])
+	pr.off += int64(i)
+	return i, nil
+}
+
+func (pr *progressiveReader) ReadAt(buf []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errNegative
+	}
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+	pr.wait(off + int64(len(buf)))
+	if off >= int64(len(pr.buf)) {
+		return 0, pr.eof()
+	}
+	i := copy(buf, pr.buf[off:])
+	if i < len(buf) {
+		return i, pr.eof()
+	}
+	return i, nil
+}
+
+func (pr *progressiveReader) Seek(offset int64, whence int) (int64, error) {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += pr.off
+	case io.SeekEnd:
+		pr.wait(math.MaxInt64)
+		offset += int64(len(pr.buf))
+	default:
+		return 0, errWhence
+	}
+	if offset < 0 {
+		return 0, errNegative
+	}
+	pr.wait(offset)
+	pr.off = offset
+	return offset, nil
+}
+
+// eof returns the error to report once all preloaded
+// data has been read. It must be called with pr.mu
+// held, after preloading has finished.
+func (pr *progressiveReader) eof() error {
+	if pr.err != nil {
+		return pr.err
+	}
+	return io.EOF
+}
+
+// Close stops preloading. Calls waiting for data
+// which has not yet arrived return ErrClosed.
+func (pr *progressiveReader) Close() error {
+	pr.cancel()
+	pr.finish(ErrClosed)
+	return nil
+}
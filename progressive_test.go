@@ -0,0 +1,78 @@
+// Copyright 2012 The Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package postpone
+
+import (
+	"io"
+	"testing"
+	"time"
+)
+
+func TestProgressive(t *testing.T) {
+	pr, pw := io.Pipe()
+	p := NewReader(pr, true)
+	p.SetProgressive(true)
+
+	go pw.Write([]byte("first"))
+	buf := make([]byte, 16)
+	if n, err := p.Read(buf); err != nil || string(buf[:n]) != "first" {
+		t.Fatalf("Read = %q, %v; want %q", buf[:n], err, "first")
+	}
+
+	seeked := make(chan int64)
+	go func() {
+		n, _ := p.Seek(0, io.SeekEnd)
+		seeked <- n
+	}()
+	select {
+	case n := <-seeked:
+		t.Fatalf("Seek to end returned %d before preloading finished", n)
+	case <-time.After(10 * time.Millisecond):
+	}
+	pw.Write([]byte("second"))
+	pw.Close()
+	if n := <-seeked; n != int64(len("firstsecond")) {
+		t.Fatalf("Seek to end = %d; want %d", n, len("firstsecond"))
+	}
+
+	if n, err := p.ReadAt(buf[:6], 5); err != nil || string(buf[:n]) != "second" {
+		t.Fatalf("ReadAt = %q, %v; want %q", buf[:n], err, "second")
+	}
+	if n, err := p.Read(buf); n != 0 || err != io.EOF {
+		t.Fatalf("Read at end = %d, %v; want 0, EOF", n, err)
+	}
+}
+
+func TestProgressiveClose(t *testing.T) {
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	p := NewReader(pr, true)
+	p.SetProgressive(true)
+
+	read := make(chan error)
+	go func() {
+		_, err := p.Read(make([]byte, 1))
+		read <- err
+	}()
+	select {
+	case err := <-read:
+		t.Fatalf("Read returned %v before any data arrived", err)
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	closed := make(chan error)
+	go func() { closed <- p.Close() }()
+	select {
+	case err := <-closed:
+		if err != nil {
+			t.Fatalf("Close() = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close blocked behind a pending Read")
+	}
+	if err := <-read; err != ErrClosed {
+		t.Fatalf("pending Read returned %v; want ErrClosed", err)
+	}
+}
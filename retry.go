@@ -0,0 +1,91 @@
+// Copyright 2012 The Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package postpone
+
+import (
+	"context"
+	"time"
+)
+
+// RetryPolicy describes how a *Postpone created by
+// NewFunc, NewFuncPre, or one of their variants
+// handles a failure of its input function.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of times the
+	// input function is called during a single load.
+	// Values less than 1 are treated as 1.
+	MaxAttempts int
+
+	// Backoff, if non-nil, returns how long to wait
+	// before the given retry, counting from 1.
+	Backoff func(retry int) time.Duration
+
+	// Retryable, if non-nil, reports whether a failure
+	// with the given error should be retried. If nil,
+	// all failures are retried.
+	Retryable func(err error) bool
+
+	// Reopen causes a load which failed with a retryable
+	// error to be attempted again by the next call to
+	// Read, Seek, or Load, instead of leaving the *Postpone
+	// permanently failed. Until then, Loaded returns false.
+	Reopen bool
+}
+
+// ExponentialBackoff returns a function, suitable for use
+// as RetryPolicy.Backoff, which waits base before the
+// first retry, and twice as long before each subsequent
+// retry, up to max.
+func ExponentialBackoff(base, max time.Duration) func(retry int) time.Duration {
+	return func(retry int) time.Duration {
+		d := base
+		for i := 1; i < retry && d < max; i++ {
+			d *= 2
+		}
+		if d > max {
+			d = max
+		}
+		return d
+	}
+}
+
+// SetRetryPolicy sets the policy p uses when its input
+// function fails. It must be called before p is first used.
+func (p *Postpone) SetRetryPolicy(rp RetryPolicy) {
+	p.retry = &rp
+}
+
+// do calls open until it succeeds, ctx is done, or rp
+// says to give up, and returns the last error encountered.
+// A nil *RetryPolicy calls open exactly once.
+func (rp *RetryPolicy) do(ctx context.Context, open func() (bool, error)) error {
+	for retry := 0; ; retry++ {
+		ok, err := open()
+		if ok || rp == nil || retry+1 >= rp.MaxAttempts || !rp.retryable(err) {
+			return err
+		}
+		var d time.Duration
+		if rp.Backoff != nil {
+			d = rp.Backoff(retry + 1)
+		}
+		t := time.NewTimer(d)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+func (rp *RetryPolicy) retryable(err error) bool {
+	return rp.Retryable == nil || rp.Retryable(err)
+}
+
+// reopen reports whether a load which failed with
+// err should be attempted again by the next load.
+func (rp *RetryPolicy) reopen(err error) bool {
+	return rp != nil && rp.Reopen && rp.retryable(err)
+}
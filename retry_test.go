@@ -0,0 +1,71 @@
+// Copyright 2012 The Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package postpone
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+var errFlaky = errors.New("flaky")
+
+// flaky returns an input function for NewFunc
+// which fails the first n times it is called.
+func flaky(n int, calls *int) func() (io.ReadSeeker, error) {
+	return func() (io.ReadSeeker, error) {
+		*calls++
+		if *calls <= n {
+			return nil, errFlaky
+		}
+		return bytes.NewReader([]byte("ok")), nil
+	}
+}
+
+func TestRetryPolicy(t *testing.T) {
+	var calls int
+	p := NewFunc(flaky(2, &calls), false)
+	p.SetRetryPolicy(RetryPolicy{
+		MaxAttempts: 3,
+		Backoff:     ExponentialBackoff(time.Millisecond, 4*time.Millisecond),
+	})
+	if err := p.Load(); err != nil {
+		t.Fatalf("Load returned %v", err)
+	}
+	if calls != 3 {
+		t.Fatalf("input function called %d times; want 3", calls)
+	}
+
+	calls = 0
+	p = NewFunc(flaky(2, &calls), false)
+	p.SetRetryPolicy(RetryPolicy{
+		MaxAttempts: 3,
+		Retryable:   func(err error) bool { return err != errFlaky },
+	})
+	if err := p.Load(); !errors.Is(err, errFlaky) {
+		t.Fatalf("Load returned %v; want %v", err, errFlaky)
+	}
+	if calls != 1 {
+		t.Fatalf("non-retryable error retried; %d calls", calls)
+	}
+}
+
+func TestRetryReopen(t *testing.T) {
+	var calls int
+	p := NewFunc(flaky(1, &calls), false)
+	p.SetRetryPolicy(RetryPolicy{Reopen: true})
+	buf := make([]byte, 2)
+	if _, err := p.Read(buf); !errors.Is(err, errFlaky) {
+		t.Fatalf("first Read returned %v; want %v", err, errFlaky)
+	}
+	if p.Loaded() {
+		t.Fatal("Loaded() = true after reopenable failure")
+	}
+	if n, err := p.Read(buf); err != nil || string(buf[:n]) != "ok" {
+		t.Fatalf("second Read = %q, %v; want %q", buf[:n], err, "ok")
+	}
+}
@@ -0,0 +1,151 @@
+// Copyright 2012 The Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package postpone
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"os"
+)
+
+// A Source is a backend from which a *Postpone created by New
+// reads. Sources are provided by File, Func, ReaderFunc, and
+// Reader, and may also be implemented outside this package.
+type Source interface {
+	// Open opens the resource, which is not done until the
+	// *Postpone is first used. If the returned reader is also
+	// an io.Seeker, the *Postpone reads from it lazily unless
+	// told to preload it; otherwise, it is preloaded. If it is
+	// an io.ReaderAt, that is used too. If it is an io.Closer,
+	// it is closed once it has been preloaded, or when the
+	// *Postpone is closed or releases it, unless the CloseSource
+	// option says otherwise. If it is not possible to open the
+	// resource, Open should return nil and any relevant error.
+	//
+	// Open may be called again after a failed open, under a
+	// RetryPolicy, and after the resource has been released,
+	// such as by Unload, a Manager, or an idle timeout.
+	Open(ctx context.Context) (io.Reader, error)
+
+	// String describes the resource, such as by its path,
+	// for use in a LoadError. It may be empty.
+	String() string
+}
+
+// A StatSource is a Source which can describe its resource
+// without opening it. It allows Stat, Size, and Seek relative
+// to the end to avoid loading a *Postpone, and Stale and
+// Refresh to detect changes to the resource.
+type StatSource interface {
+	Source
+	Stat(ctx context.Context) (fs.FileInfo, error)
+}
+
+// A RangeSource is a Source which can open part of its
+// resource. Unless the *Postpone is configured to preload,
+// limit, map or cache its resource, or is registered with a
+// Manager, ReadAt uses OpenRange rather than loading it, and
+// once it has been loaded, rather than being serialized with
+// its other methods if the reader returned by Open is not an
+// io.ReaderAt.
+type RangeSource interface {
+	Source
+	// OpenRange opens n bytes of the resource, starting at
+	// offset off. Fewer bytes are read if the resource ends
+	// first. If the returned reader is an io.Closer, it is
+	// closed once read from.
+	OpenRange(ctx context.Context, off, n int64) (io.Reader, error)
+}
+
+// File returns a Source which opens file. Unless the
+// CloseSource option says otherwise, the file is closed
+// once it has been preloaded, or when the *Postpone is
+// closed. The Source implements StatSource.
+func File(file string) Source {
+	return &fileSource{file: file}
+}
+
+// Func returns a Source which calls r to open the
+// resource, as does NewFuncContext. Unless the Preload
+// option is given, the resource is read from lazily.
+func Func(r func(context.Context) (io.ReadSeeker, error)) Source {
+	return funcSource(r)
+}
+
+// ReaderFunc returns a Source which calls r to open the
+// resource, as does NewFuncPreContext. The resource is
+// preloaded, unless the Cached option is given.
+func ReaderFunc(r func(context.Context) (io.Reader, error)) Source {
+	return readerFuncSource(r)
+}
+
+// Reader returns a Source which reads from r, as does
+// NewReader. Since r cannot be read again, it is preloaded,
+// unless the Cached option is given, and it cannot be
+// reopened once released.
+func Reader(r io.Reader) Source {
+	return &readerSource{r}
+}
+
+type fileSource struct {
+	file string
+	mmap bool
+}
+
+func (s *fileSource) Open(context.Context) (io.Reader, error) {
+	if s.mmap {
+		return openMmap(s.file)
+	}
+	f, err := os.Open(s.file)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (s *fileSource) Stat(context.Context) (fs.FileInfo, error) {
+	return os.Stat(s.file)
+}
+
+func (s *fileSource) String() string {
+	return s.file
+}
+
+type funcSource func(context.Context) (io.ReadSeeker, error)
+
+func (s funcSource) Open(ctx context.Context) (io.Reader, error) {
+	rs, err := s(ctx)
+	if rs == nil {
+		return nil, err
+	}
+	return rs, err
+}
+
+func (s funcSource) String() string {
+	return ""
+}
+
+type readerFuncSource func(context.Context) (io.Reader, error)
+
+func (s readerFuncSource) Open(ctx context.Context) (io.Reader, error) {
+	return s(ctx)
+}
+
+func (s readerFuncSource) String() string {
+	return ""
+}
+
+type readerSource struct {
+	r io.Reader
+}
+
+func (s *readerSource) Open(context.Context) (io.Reader, error) {
+	return s.r, nil
+}
+
+func (s *readerSource) String() string {
+	return ""
+}
@@ -0,0 +1,223 @@
+// Copyright 2012 The Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package postpone
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// blobSource is an in-memory stand-in for a remote object
+// store, implementing StatSource and RangeSource.
+type blobSource struct {
+	mu      sync.Mutex
+	name    string
+	data    string
+	mod     time.Time
+	opens   int
+	ranges  int
+	closes  int
+	openErr error
+	stream  bool // whether Open returns a reader which cannot seek
+}
+
+func (b *blobSource) Open(context.Context) (io.Reader, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.opens++
+	if b.openErr != nil {
+		return nil, b.openErr
+	}
+	if b.stream {
+		return &blobBody{strings.NewReader(b.data), b}, nil
+	}
+	// Hide ReadAt, so that ReadAt must use OpenRange.
+	return struct{ io.ReadSeeker }{strings.NewReader(b.data)}, nil
+}
+
+// blobBody is a response body, which can be neither
+// seeked nor read from at an offset.
+type blobBody struct {
+	r io.Reader
+	b *blobSource
+}
+
+func (body *blobBody) Read(buf []byte) (int, error) {
+	return body.r.Read(buf)
+}
+
+func (body *blobBody) Close() error {
+	body.b.mu.Lock()
+	defer body.b.mu.Unlock()
+	body.b.closes++
+	return nil
+}
+
+func (b *blobSource) OpenRange(ctx context.Context, off, n int64) (io.Reader, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.ranges++
+	return io.NewSectionReader(strings.NewReader(b.data), off, n), nil
+}
+
+func (b *blobSource) Stat(context.Context) (fs.FileInfo, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return blobInfo{b.name, int64(len(b.data)), b.mod}, nil
+}
+
+func (b *blobSource) String() string {
+	return b.name
+}
+
+func (b *blobSource) set(data string, mod time.Time) {
+	b.mu.Lock()
+	b.data, b.mod = data, mod
+	b.mu.Unlock()
+}
+
+type blobInfo struct {
+	name string
+	size int64
+	mod  time.Time
+}
+
+func (fi blobInfo) Name() string       { return fi.name }
+func (fi blobInfo) Size() int64        { return fi.size }
+func (fi blobInfo) Mode() fs.FileMode  { return 0444 }
+func (fi blobInfo) ModTime() time.Time { return fi.mod }
+func (fi blobInfo) IsDir() bool        { return false }
+func (fi blobInfo) Sys() interface{}   { return nil }
+
+func TestCustomSource(t *testing.T) {
+	b := &blobSource{name: "bucket/object", data: "abcdefgh", mod: time.Unix(1, 0)}
+	p := New(b)
+	if size, err := p.Size(); err != nil || size != 8 {
+		t.Fatalf("Size() = %d, %v; want 8, nil", size, err)
+	}
+	if b.opens != 0 {
+		t.Fatalf("Size() opened the Source %d times; want 0", b.opens)
+	}
+
+	buf := make([]byte, 3)
+	if i, err := p.ReadAt(buf, 6); err != io.EOF || string(buf[:i]) != "gh" {
+		t.Fatalf("ReadAt(6) = %q, %v; want %q, io.EOF", buf[:i], err, "gh")
+	}
+	if b.ranges != 1 {
+		t.Fatalf("ReadAt used OpenRange %d times; want 1", b.ranges)
+	}
+	if i, err := p.Read(buf); err != nil || string(buf[:i]) != "abc" {
+		t.Fatalf("Read() = %q, %v; want %q", buf[:i], err, "abc")
+	}
+	if b.opens != 1 {
+		t.Fatalf("Source opened %d times; want 1", b.opens)
+	}
+
+	b.set("ABCDEFGHIJ", time.Unix(2, 0))
+	if stale, err := p.Stale(); !stale || err != nil {
+		t.Fatalf("Stale() of changed Source = %v, %v; want true, nil", stale, err)
+	}
+	if err := p.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if rest, err := ioutil.ReadAll(p); err != nil || string(rest) != "DEFGHIJ" {
+		t.Fatalf("ReadAll after Refresh = %q, %v; want %q", rest, err, "DEFGHIJ")
+	}
+}
+
+func TestCustomSourceError(t *testing.T) {
+	errDown := errors.New("service unavailable")
+	p := New(&blobSource{name: "bucket/object", openErr: errDown})
+	_, err := p.Read(make([]byte, 1))
+	var le *LoadError
+	if !errors.As(err, &le) || le.Source != "bucket/object" || !errors.Is(err, errDown) {
+		t.Fatalf("Read() error = %v; want *LoadError from %q wrapping %v", err, "bucket/object", errDown)
+	}
+	if _, err := NewReader(strings.NewReader("x"), false).Stale(); err != errNoStat {
+		t.Fatalf("Stale() of Reader Source error = %v; want %v", err, errNoStat)
+	}
+}
+
+func TestCustomStreamSource(t *testing.T) {
+	b := &blobSource{name: "bucket/object", data: "abcdefgh", stream: true}
+	p := New(b)
+	buf := make([]byte, 3)
+	if i, err := p.ReadAt(buf, 2); err != nil || string(buf[:i]) != "cde" {
+		t.Fatalf("ReadAt(2) = %q, %v; want %q", buf[:i], err, "cde")
+	}
+	if b.opens != 0 || b.ranges != 1 || p.Loaded() {
+		t.Fatalf("ReadAt opened the Source %d times and used OpenRange %d times; want 0 and 1", b.opens, b.ranges)
+	}
+
+	if i, err := p.Read(buf); err != nil || string(buf[:i]) != "abc" {
+		t.Fatalf("Read() = %q, %v; want %q", buf[:i], err, "abc")
+	}
+	if b.opens != 1 || b.closes != 1 {
+		t.Fatalf("Read opened the Source %d times and closed it %d times; want 1 and 1", b.opens, b.closes)
+	}
+	if i, err := p.ReadAt(buf, 5); err != nil || string(buf[:i]) != "fgh" {
+		t.Fatalf("ReadAt(5) after load = %q, %v; want %q", buf[:i], err, "fgh")
+	}
+	if b.ranges != 1 {
+		t.Fatalf("ReadAt used OpenRange %d times after load; want 1", b.ranges)
+	}
+}
+
+func TestReadAtRangeSourceOptIn(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "file")
+	if err := ioutil.WriteFile(name, []byte("abcde"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 2)
+	for _, p := range []*Postpone{NewFile(name), NewFilePre(name), NewFileMmap(name)} {
+		if _, err := p.ReadAt(buf, 1); err != nil {
+			t.Fatal(err)
+		}
+		if !p.Loaded() {
+			t.Fatal("ReadAt did not load a file-backed Postpone")
+		}
+	}
+	fm := NewManager(1)
+	for i := 0; i < 3; i++ {
+		p := New(File(name), Managed(fm))
+		if _, err := p.ReadAt(buf, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := fm.Len(); n != 1 {
+		t.Fatalf("Manager holds %d files after ReadAt; want 1", n)
+	}
+	p := NewFilePre(name)
+	p.SetLimit(4)
+	if _, err := p.ReadAt(buf, 0); !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("ReadAt over limit = %v; want ErrTooLarge", err)
+	}
+
+	b := &blobSource{name: "bucket/object", data: "abcdefgh", stream: true}
+	for _, p := range []*Postpone{New(b, Preload()), New(b, Cached()), New(b, Limit(100))} {
+		if _, err := p.ReadAt(buf, 1); err != nil {
+			t.Fatal(err)
+		}
+		if !p.Loaded() {
+			t.Fatal("ReadAt used OpenRange on a Postpone configured to load")
+		}
+	}
+	m := NewManager(1)
+	p = New(b, Managed(m))
+	if _, err := p.ReadAt(buf, 1); err != nil {
+		t.Fatal(err)
+	}
+	if b.ranges != 0 {
+		t.Fatalf("OpenRange used %d times; want 0", b.ranges)
+	}
+}
@@ -0,0 +1,138 @@
+// Copyright 2012 The Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package postpone
+
+import (
+	"context"
+	"io"
+	"os"
+)
+
+// SetSpill causes p to preload at most threshold bytes
+// into memory, and to write the remainder to a temporary
+// file in dir, which is removed when p is closed. If dir
+// is empty, the default directory for temporary files is
+// used. A threshold of 0 or less disables spilling, which
+// is the default. SetSpill must be called before p is first
+// used, and has no effect unless p preloads.
+func (p *Postpone) SetSpill(threshold int64, dir string) {
+	p.spill, p.tmpdir = threshold, dir
+}
+
+// spillReader is a preloaded buffer holding its first
+// len(mem) bytes in memory and the remainder, if any,
+// in the temporary file f.
+type spillReader struct {
+	mem  []byte
+	f    *os.File
+	size int64
+	off  int64
+}
+
+// spill reads all of r into a *spillReader, keeping at most
+// threshold bytes in memory. As with readAll, the returned
+// *spillReader holds whatever was read before any error.
+func spill(ctx context.Context, r io.Reader, threshold int64, dir string) (*spillReader, error) {
+	mem, err := readAll(ctx, io.LimitReader(r, threshold))
+	s := &spillReader{mem: mem, size: int64(len(mem))}
+	if err != nil || s.size < threshold {
+		return s, err
+	}
+	// Only create the temporary file if there is
+	// something beyond threshold to spill into it.
+	var peek [1]byte
+	if _, err = io.ReadFull(r, peek[:]); err != nil {
+		if err == io.EOF {
+			err = nil
+		}
+		return s, err
+	}
+	s.f, err = os.CreateTemp(dir, "postpone-")
+	if err != nil {
+		return s, err
+	}
+	if _, err = s.f.Write(peek[:]); err != nil {
+		return s, err
+	}
+	s.size++
+	for {
+		if err = ctx.Err(); err != nil {
+			return s, err
+		}
+		var n int64
+		n, err = io.CopyN(s.f, r, preloadChunk)
+		s.size += n
+		if err == io.EOF {
+			return s, nil
+		}
+		if err != nil {
+			return s, err
+		}
+	}
+}
+
+func (s *spillReader) Read(buf []byte) (int, error) {
+	i, err := s.ReadAt(buf, s.off)
+	s.off += int64(i)
+	if i > 0 && err == io.EOF {
+		err = nil
+	}
+	return i, err
+}
+
+func (s *spillReader) ReadAt(buf []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errNegative
+	}
+	if off >= s.size {
+		return 0, io.EOF
+	}
+	var i int
+	mem := int64(len(s.mem))
+	if off < mem {
+		i = copy(buf, s.mem[off:])
+	}
+	if i < len(buf) && s.f != nil {
+		j, err := s.f.ReadAt(buf[i:], off+int64(i)-mem)
+		i += j
+		if err != nil && err != io.EOF {
+			return i, err
+		}
+	}
+	if i < len(buf) {
+		return i, io.EOF
+	}
+	return i, nil
+}
+
+func (s *spillReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += s.off
+	case io.SeekEnd:
+		offset += s.size
+	default:
+		return 0, errWhence
+	}
+	if offset < 0 {
+		return 0, errNegative
+	}
+	s.off = offset
+	return offset, nil
+}
+
+// Close closes and removes the temporary file, if any.
+func (s *spillReader) Close() error {
+	if s.f == nil {
+		return nil
+	}
+	err := s.f.Close()
+	if rerr := os.Remove(s.f.Name()); err == nil {
+		err = rerr
+	}
+	s.f = nil
+	return err
+}
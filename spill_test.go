@@ -0,0 +1,68 @@
+// Copyright 2012 The Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package postpone
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestSpill(t *testing.T) {
+	data := make([]byte, 3*preloadChunk+17)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	dir := t.TempDir()
+	p := NewReader(bytes.NewReader(data), false)
+	p.SetSpill(100, dir)
+	if err := p.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if ents, _ := os.ReadDir(dir); len(ents) != 1 {
+		t.Fatalf("%d files in spill directory; want 1", len(ents))
+	}
+
+	buf := make([]byte, 200)
+	if n, err := p.ReadAt(buf, 50); n != len(buf) || err != nil || !bytes.Equal(buf, data[50:250]) {
+		t.Fatalf("ReadAt across spill boundary = %d, %v", n, err)
+	}
+	if _, err := p.Seek(-10, io.SeekEnd); err != nil {
+		t.Fatal(err)
+	}
+	if rest, err := ioutil.ReadAll(p); err != nil || !bytes.Equal(rest, data[len(data)-10:]) {
+		t.Fatalf("ReadAll of tail = %d bytes, %v", len(rest), err)
+	}
+	if _, err := p.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if all, err := ioutil.ReadAll(p); err != nil || !bytes.Equal(all, data) {
+		t.Fatalf("ReadAll = %d bytes, %v; want %d bytes", len(all), err, len(data))
+	}
+
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if ents, _ := os.ReadDir(dir); len(ents) != 0 {
+		t.Fatalf("Close left %d files in spill directory", len(ents))
+	}
+}
+
+func TestSpillExactThreshold(t *testing.T) {
+	dir := t.TempDir()
+	p := NewReader(bytes.NewReader(make([]byte, 100)), false)
+	p.SetSpill(100, dir)
+	if err := p.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if ents, _ := os.ReadDir(dir); len(ents) != 0 {
+		t.Fatalf("%d files in spill directory; want 0", len(ents))
+	}
+	if size, err := p.Seek(0, io.SeekEnd); err != nil || size != 100 {
+		t.Fatalf("Seek to end = %d, %v; want 100, nil", size, err)
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright 2012 The Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package postpone
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"time"
+)
+
+// errNoStat is returned by Stale and Refresh for a *Postpone
+// whose Source is not a StatSource.
+var errNoStat = errors.New("postpone: Source cannot be checked for changes")
+
+// Stale reports whether the resource underlying p has changed
+// since p was loaded, that is, whether its size or modification
+// time differs from that of the resource p loaded, or, for a
+// File Source, whether its identity (such as its inode) does.
+// If p has not been loaded, Stale returns false, and if p has
+// been closed, it returns ErrClosed. Stale is only supported for
+// a *Postpone whose Source is a StatSource, such as one created
+// by NewFile, NewFilePre, or NewFileMmap.
+func (p *Postpone) Stale() (bool, error) {
+	p.mu.RLock()
+	src, info, closed := p.src, p.info, p.closed
+	p.mu.RUnlock()
+	if closed {
+		return false, ErrClosed
+	}
+	ss, ok := src.(StatSource)
+	if !ok {
+		return false, errNoStat
+	}
+	if info == nil {
+		return false, nil
+	}
+	fi, err := ss.Stat(context.Background())
+	if err != nil {
+		return false, err
+	}
+	if _, ok := src.(*fileSource); ok && !os.SameFile(info, fi) {
+		return true, nil
+	}
+	return info.Size() != fi.Size() || !info.ModTime().Equal(fi.ModTime()), nil
+}
+
+// Refresh loads p again if its underlying resource is stale,
+// replacing the previously loaded content. Concurrent calls
+// to Read, Seek and ReadAt see either the old or the new
+// content, never a mixture. The current offset is kept,
+// unless the new content is shorter, in which case the
+// offset is moved to its end. If the reload fails, p keeps
+// its old content, and Refresh returns the error.
+func (p *Postpone) Refresh() error {
+	_, _, _, err := p.refresh(context.Background())
+	return err
+}
+
+// SetAutoRefresh causes each Read from p to first call
+// Refresh, if at least every has passed since p was last
+// loaded or checked for staleness. Errors encountered
+// while refreshing are ignored, and p keeps serving its
+// old content. An every of 0 or less disables automatic
+// refreshing, which is the default. SetAutoRefresh must
+// be called before p is first used.
+func (p *Postpone) SetAutoRefresh(every time.Duration) {
+	p.refreshEvery = every
+}
+
+// autoRefresh refreshes p if it is due to be checked for
+// staleness. It must be called without p.mu held.
+func (p *Postpone) autoRefresh() {
+	if p.refreshEvery <= 0 {
+		return
+	}
+	p.mu.Lock()
+	due := p.loaded && !p.bad && time.Since(p.checked) >= p.refreshEvery
+	if due {
+		p.checked = time.Now()
+	}
+	p.mu.Unlock()
+	if due {
+		p.refresh(context.Background())
+	}
+}
+
+// refresh reloads p if its underlying resource is stale. It
+// reports whether it did so, along with the sizes of the
+// resource as of the previous and new loads.
+func (p *Postpone) refresh(ctx context.Context) (refreshed bool, oldSize, newSize int64, err error) {
+	p.refreshMu.Lock()
+	defer p.refreshMu.Unlock()
+	stale, err := p.Stale()
+	if err != nil || !stale {
+		return false, 0, 0, err
+	}
+	// As in load, the context the resource is opened with is
+	// only canceled once it has been closed; ctx, which may be
+	// that of a Watcher, only aborts the reload.
+	octx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	stop := context.AfterFunc(ctx, cancel)
+	res := p.retreive(octx)
+	stop()
+	res.cancel = cancel
+	if res.bad {
+		cancel()
+	}
+	if p.onLoad != nil {
+		p.onLoad(res.err)
+	}
+	if res.bad {
+		return false, 0, 0, res.err
+	}
+	if newSize, err = res.rs.Seek(0, io.SeekEnd); err != nil {
+		res.close()
+		return false, 0, 0, p.loadError(opOpen, err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.loaded || p.bad || p.closed {
+		// p was unloaded or closed while reloading.
+		res.close()
+		return false, 0, 0, nil
+	}
+	off, err := p.rs.Seek(0, io.SeekCurrent)
+	if err == nil {
+		if off > newSize {
+			off = newSize
+		}
+		_, err = res.rs.Seek(off, io.SeekStart)
+	}
+	if err != nil {
+		res.close()
+		return false, 0, 0, p.loadError(opOpen, err)
+	}
+	if p.info != nil {
+		oldSize = p.info.Size()
+	}
+	if p.closer != nil {
+		p.closer.Close()
+	}
+	p.cancelOpen()
+	p.rs, p.err, p.quiet, p.closer = res.rs, res.err, res.quiet, res.closer
+	p.closeCtx = res.cancel
+	p.setWake(p.rs)
+	p.info, p.lazy, p.checked = res.info, res.lazy, time.Now()
+	return true, oldSize, newSize, nil
+}
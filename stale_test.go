@@ -0,0 +1,76 @@
+// Copyright 2012 The Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package postpone
+
+import (
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRefresh(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "config")
+	if err := ioutil.WriteFile(name, []byte("abcdef"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	p := NewFilePre(name)
+	if stale, err := p.Stale(); stale || err != nil {
+		t.Fatalf("Stale() before load = %v, %v; want false, nil", stale, err)
+	}
+	buf := make([]byte, 4)
+	if _, err := p.Read(buf); err != nil {
+		t.Fatal(err)
+	}
+	if stale, err := p.Stale(); stale || err != nil {
+		t.Fatalf("Stale() of unchanged file = %v, %v; want false, nil", stale, err)
+	}
+
+	if err := ioutil.WriteFile(name, []byte("ABCDEFGH"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if stale, err := p.Stale(); !stale || err != nil {
+		t.Fatalf("Stale() of changed file = %v, %v; want true, nil", stale, err)
+	}
+	if err := p.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if stale, err := p.Stale(); stale || err != nil {
+		t.Fatalf("Stale() after Refresh = %v, %v; want false, nil", stale, err)
+	}
+	if rest, err := ioutil.ReadAll(p); err != nil || string(rest) != "EFGH" {
+		t.Fatalf("ReadAll after Refresh = %q, %v; want %q", rest, err, "EFGH")
+	}
+
+	if err := ioutil.WriteFile(name, []byte("xy"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if off, err := p.Seek(0, io.SeekCurrent); err != nil || off != 2 {
+		t.Fatalf("offset after shrinking Refresh = %d, %v; want 2", off, err)
+	}
+}
+
+func TestAutoRefresh(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "config")
+	if err := ioutil.WriteFile(name, []byte("old"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	p := NewFilePre(name)
+	p.SetAutoRefresh(time.Nanosecond)
+	if err := p.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(name, []byte("new!"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond)
+	if buf, err := ioutil.ReadAll(p); err != nil || string(buf) != "new!" {
+		t.Fatalf("ReadAll = %q, %v; want %q", buf, err, "new!")
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright 2012 The Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package postpone
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"time"
+)
+
+// SetSizeHint tells p the size of its underlying resource,
+// so that Stat and Size can report it without loading p.
+// SetSizeHint must be called before p is first used.
+func (p *Postpone) SetSizeHint(size int64) {
+	p.hint, p.hasHint = size, true
+}
+
+// Stat returns an fs.FileInfo describing the resource
+// underlying p, loading p only if there is no cheaper way.
+// If p has not been loaded, and its Source is a StatSource,
+// such as the Source underlying a *Postpone created by NewFile,
+// NewFilePre, or NewFileMmap, the resource is described by the
+// Source, without being opened; otherwise the size given to
+// SetSizeHint, if any, is reported. Failing that, p
+// is loaded, and its size determined without affecting the
+// offset used by Read and Seek. Once p has been loaded, a
+// resource which is read from lazily, such as the file
+// underlying a *Postpone created by NewFile, is described as
+// it is now, while a preloaded one is described as it was
+// when it was preloaded.
+func (p *Postpone) Stat() (fs.FileInfo, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return nil, ErrClosed
+	}
+	if !p.loaded {
+		if ss, ok := p.src.(StatSource); ok {
+			return ss.Stat(context.Background())
+		}
+		if p.hasHint {
+			return fileInfo{p.name, p.hint}, nil
+		}
+	}
+	p.load(context.Background())
+	if p.closed {
+		return nil, ErrClosed
+	}
+	if p.bad {
+		return nil, p.err
+	}
+	if p.lazy {
+		// Unlike a preloaded snapshot, a resource which is read
+		// from lazily may have changed since it was opened.
+		if fi := statOf(p.rs); fi != nil {
+			return fi, nil
+		}
+		if ss, ok := p.src.(StatSource); ok {
+			if fi, err := ss.Stat(context.Background()); err == nil {
+				return fi, nil
+			}
+		}
+	}
+	if p.info != nil {
+		return p.info, nil
+	}
+	size, err := seekSize(p.rs)
+	if err != nil {
+		return nil, err
+	}
+	return fileInfo{p.name, size}, nil
+}
+
+// Size returns the size of the resource underlying p,
+// as reported by Stat.
+func (p *Postpone) Size() (int64, error) {
+	fi, err := p.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return fi.Size(), nil
+}
+
+// seekSize returns the size of rs, as determined by
+// seeking to its end, and restores its offset.
+func seekSize(rs io.ReadSeeker) (int64, error) {
+	cur, err := rs.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+	size, err := rs.Seek(0, io.SeekEnd)
+	if _, serr := rs.Seek(cur, io.SeekStart); err == nil {
+		err = serr
+	}
+	return size, err
+}
+
+// fileInfo is the fs.FileInfo reported by Stat for
+// resources which cannot describe themselves.
+type fileInfo struct {
+	name string
+	size int64
+}
+
+func (fi fileInfo) Name() string       { return filepath.Base(fi.name) }
+func (fi fileInfo) Size() int64        { return fi.size }
+func (fi fileInfo) Mode() fs.FileMode  { return 0444 }
+func (fi fileInfo) ModTime() time.Time { return time.Time{} }
+func (fi fileInfo) IsDir() bool        { return false }
+func (fi fileInfo) Sys() interface{}   { return nil }
@@ -0,0 +1,120 @@
+// Copyright 2012 The Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package postpone
+
+import (
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStat(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "sized")
+	if err := ioutil.WriteFile(name, []byte("12345"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []*Postpone{NewFile(name), NewFilePre(name)} {
+		fi, err := p.Stat()
+		if err != nil || fi.Size() != 5 || fi.Name() != "sized" {
+			t.Fatalf("Stat() = %v, %v; want size 5", fi, err)
+		}
+		if p.Loaded() {
+			t.Fatal("Stat loaded a file-backed Postpone")
+		}
+	}
+
+	var opens int
+	open := func() (io.ReadSeeker, error) {
+		opens++
+		return strings.NewReader("1234567"), nil
+	}
+	p := NewFunc(open, false)
+	p.SetSizeHint(7)
+	if size, err := p.Size(); err != nil || size != 7 || opens != 0 {
+		t.Fatalf("Size() with hint = %d, %v after %d opens; want 7, nil after 0", size, err, opens)
+	}
+
+	p = NewFunc(open, false)
+	if _, err := p.Seek(3, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if size, err := p.Size(); err != nil || size != 7 {
+		t.Fatalf("Size() without hint = %d, %v; want 7", size, err)
+	}
+	if off, err := p.Seek(0, io.SeekCurrent); err != nil || off != 3 {
+		t.Fatalf("offset after Size() = %d, %v; want 3", off, err)
+	}
+}
+
+func TestStatLoaded(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "growing")
+	if err := ioutil.WriteFile(name, []byte("12345"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	lazy, pre := NewFile(name), NewFilePre(name)
+	for _, p := range []*Postpone{lazy, pre} {
+		if err := p.Load(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ioutil.WriteFile(name, []byte("1234567"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if size, err := lazy.Size(); err != nil || size != 7 {
+		t.Fatalf("Size() of grown lazy file = %d, %v; want 7", size, err)
+	}
+	if size, err := pre.Size(); err != nil || size != 5 {
+		t.Fatalf("Size() of preloaded file = %d, %v; want 5", size, err)
+	}
+}
+
+func TestDeferredSeek(t *testing.T) {
+	var opens int
+	p := NewFunc(func() (io.ReadSeeker, error) {
+		opens++
+		return strings.NewReader("0123456789"), nil
+	}, false)
+	if off, err := p.Seek(5, io.SeekStart); err != nil || off != 5 {
+		t.Fatalf("Seek = %d, %v; want 5", off, err)
+	}
+	if off, err := p.Seek(-2, io.SeekCurrent); err != nil || off != 3 {
+		t.Fatalf("Seek = %d, %v; want 3", off, err)
+	}
+	if _, err := p.Seek(-4, io.SeekCurrent); err == nil {
+		t.Fatal("Seek to negative position succeeded")
+	}
+	if opens != 0 || p.Loaded() {
+		t.Fatal("Seek loaded the Postpone")
+	}
+	buf := make([]byte, 2)
+	if n, err := p.Read(buf); err != nil || string(buf[:n]) != "34" {
+		t.Fatalf("Read after deferred Seek = %q, %v; want %q", buf[:n], err, "34")
+	}
+
+	name := filepath.Join(t.TempDir(), "chunk")
+	if err := ioutil.WriteFile(name, []byte("header:body"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	p = NewFile(name)
+	if off, err := p.Seek(-4, io.SeekEnd); err != nil || off != 7 {
+		t.Fatalf("Seek from end = %d, %v; want 7", off, err)
+	}
+	if p.Loaded() {
+		t.Fatal("Seek from end opened the file")
+	}
+	if rest, err := ioutil.ReadAll(p); err != nil || string(rest) != "body" {
+		t.Fatalf("ReadAll after Seek from end = %q, %v; want %q", rest, err, "body")
+	}
+
+	p = NewFile(name)
+	if _, err := p.Seek(100, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := p.Read(buf); n != 0 || err != io.EOF {
+		t.Fatalf("Read past end = %d, %v; want 0, EOF", n, err)
+	}
+}
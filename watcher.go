@@ -0,0 +1,109 @@
+// Copyright 2012 The Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package postpone
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// defaultWatchInterval is how often a Watcher checks for
+// changes if Watch is given no positive interval.
+const defaultWatchInterval = time.Second
+
+// A Watcher polls the file underlying a *Postpone for changes,
+// refreshing the *Postpone, as by Refresh, whenever the file
+// changes, and then notifying its subscribers. Since a refresh
+// replaces the content of the *Postpone atomically, readers
+// never see a mixture of old and new content from a single call.
+type Watcher struct {
+	p        *Postpone
+	interval time.Duration
+
+	mu   sync.Mutex
+	subs []func(oldSize, newSize int64)
+
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// Watch starts a Watcher which checks the file underlying p
+// every interval. p must have been created by NewFile,
+// NewFilePre, or NewFileMmap; NewFilePre is typical. Changes
+// are detected relative to the most recent load of p, so
+// nothing is detected until p has first been loaded. Errors
+// encountered while checking or reloading are ignored, and p
+// keeps serving its old content. The Watcher stops of its
+// own accord once p is closed. If interval is 0 or less,
+// p is checked every second.
+func Watch(p *Postpone, interval time.Duration) *Watcher {
+	if interval <= 0 {
+		interval = defaultWatchInterval
+	}
+	w := &Watcher{
+		p:        p,
+		interval: interval,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+// Subscribe registers fn to be called after each refresh,
+// with the sizes of the file before and after the change.
+// Subscribers are called in the order in which they were
+// registered, one at a time, from the Watcher's goroutine.
+func (w *Watcher) Subscribe(fn func(oldSize, newSize int64)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.subs = append(w.subs, fn)
+}
+
+// Stop stops w, and waits for any refresh or notification
+// in progress to finish. It does not close the *Postpone.
+// Calling Stop more than once has no further effect.
+func (w *Watcher) Stop() {
+	w.stopOnce.Do(func() { close(w.stop) })
+	<-w.done
+}
+
+func (w *Watcher) run() {
+	defer close(w.done)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-w.stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	t := time.NewTicker(w.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+		case <-w.stop:
+			return
+		}
+		refreshed, oldSize, newSize, err := w.p.refresh(ctx)
+		if err == ErrClosed {
+			return
+		}
+		if !refreshed {
+			continue
+		}
+		w.mu.Lock()
+		subs := w.subs
+		w.mu.Unlock()
+		for _, fn := range subs {
+			fn(oldSize, newSize)
+		}
+	}
+}
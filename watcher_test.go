@@ -0,0 +1,88 @@
+// Copyright 2012 The Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package postpone
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatcher(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "watched")
+	if err := ioutil.WriteFile(name, []byte("old"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	p := NewFilePre(name)
+	defer p.Close()
+	if err := p.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	w := Watch(p, time.Millisecond)
+	defer w.Stop()
+	type change struct{ oldSize, newSize int64 }
+	changes := make(chan change, 1)
+	w.Subscribe(func(oldSize, newSize int64) {
+		changes <- change{oldSize, newSize}
+	})
+
+	if err := ioutil.WriteFile(name, []byte("newer"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case c := <-changes:
+		if c.oldSize != 3 || c.newSize != 5 {
+			t.Fatalf("subscriber called with sizes %d, %d; want 3, 5", c.oldSize, c.newSize)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("subscriber not called after file changed")
+	}
+	if _, err := p.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if buf, err := ioutil.ReadAll(p); err != nil || string(buf) != "newer" {
+		t.Fatalf("ReadAll after change = %q, %v; want %q", buf, err, "newer")
+	}
+
+	w.Stop()
+	if err := ioutil.WriteFile(name, []byte("newest"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	select {
+	case <-changes:
+		t.Fatal("subscriber called after Stop")
+	default:
+	}
+}
+
+func TestWatcherStopsOnClose(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "watched")
+	if err := ioutil.WriteFile(name, []byte("data"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	p := NewFilePre(name)
+	w := Watch(p, time.Millisecond)
+	p.Close()
+	select {
+	case <-w.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Watcher did not stop after its Postpone was closed")
+	}
+}
+
+func TestWatchDefaultInterval(t *testing.T) {
+	for _, interval := range []time.Duration{0, -time.Second} {
+		w := Watch(NewReader(bytes.NewReader(nil), false), interval)
+		if w.interval != defaultWatchInterval {
+			t.Errorf("Watch(p, %v) interval = %v; want %v", interval, w.interval, defaultWatchInterval)
+		}
+		w.Stop()
+	}
+}
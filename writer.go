@@ -0,0 +1,100 @@
+// Copyright 2012 The Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package postpone
+
+import (
+	"os"
+	"sync"
+)
+
+// Writer fulfills the io.WriteSeeker and io.WriteCloser
+// interfaces. It postpones opening its file until the first
+// call to Write or Seek, so that a Writer which is never
+// written to never touches the filesystem. It is safe for
+// concurrent use.
+type Writer struct {
+	mu     sync.Mutex
+	file   string
+	flag   int
+	perm   os.FileMode
+	f      *os.File
+	err    error
+	closed bool
+}
+
+// NewFileWriter takes a filepath, and returns a *Writer. This
+// *Writer will wait to open the file until the first call to
+// either Write or Seek, at which point the file is opened with
+// flag and perm, as by os.OpenFile. flag must allow writing;
+// os.O_WRONLY|os.O_CREATE|os.O_TRUNC is typical.
+func NewFileWriter(file string, flag int, perm os.FileMode) *Writer {
+	return &Writer{file: file, flag: flag, perm: perm}
+}
+
+// Opened returns whether or not w has opened its file.
+func (w *Writer) Opened() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.f != nil
+}
+
+func (w *Writer) Write(buf []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(buf) == 0 && w.f == nil {
+		// Don't create the file for an empty write.
+		if w.closed {
+			return 0, ErrClosed
+		}
+		return 0, w.err
+	}
+	if err := w.open(); err != nil {
+		return 0, err
+	}
+	return w.f.Write(buf)
+}
+
+func (w *Writer) Seek(offset int64, whence int) (int64, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.open(); err != nil {
+		return 0, err
+	}
+	return w.f.Seek(offset, whence)
+}
+
+// Close closes w's file, if it has been opened. After
+// Close, Write and Seek return ErrClosed, as does any
+// subsequent call to Close.
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return ErrClosed
+	}
+	w.closed = true
+	if w.f == nil {
+		return nil
+	}
+	return w.f.Close()
+}
+
+// open opens w's file if it has not been opened yet, and
+// returns any error encountered while doing so, now or
+// previously. It must be called with w.mu held.
+func (w *Writer) open() error {
+	if w.closed {
+		return ErrClosed
+	}
+	if w.f == nil && w.err == nil {
+		f, err := os.OpenFile(w.file, w.flag, w.perm)
+		if err != nil {
+			w.err = &LoadError{Op: opOpen, Source: w.file, Err: err}
+		} else {
+			w.f = f
+		}
+	}
+	return w.err
+}
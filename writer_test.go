@@ -0,0 +1,69 @@
+// Copyright 2012 The Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package postpone
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileWriter(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "out")
+	flag := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+
+	w := NewFileWriter(name, flag, 0600)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(name); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("unwritten Writer created its file: %v", err)
+	}
+
+	w = NewFileWriter(name, flag, 0600)
+	if n, err := w.Write(nil); n != 0 || err != nil {
+		t.Fatalf("empty Write = %d, %v; want 0, nil", n, err)
+	}
+	if w.Opened() {
+		t.Fatal("empty Write opened the file")
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(name); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("empty Write created the file: %v", err)
+	}
+
+	w = NewFileWriter(name, flag, 0600)
+	if _, err := w.Write([]byte("hello world")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Seek(6, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte("there")); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte("!")); err != ErrClosed {
+		t.Fatalf("Write after Close returned %v; want ErrClosed", err)
+	}
+	if buf, err := ioutil.ReadFile(name); err != nil || string(buf) != "hello there" {
+		t.Fatalf("file contains %q, %v; want %q", buf, err, "hello there")
+	}
+
+	w = NewFileWriter(filepath.Join(dir, "missing", "out"), flag, 0600)
+	var le *LoadError
+	if _, err := w.Write([]byte("x")); !errors.As(err, &le) || !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("Write to missing directory returned %v; want *LoadError wrapping fs.ErrNotExist", err)
+	}
+}